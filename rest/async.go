@@ -0,0 +1,670 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/pkg/errors"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/logging"
+
+	providerGen "github.com/cloudy-sky-software/pulschema/pkg"
+)
+
+const (
+	headerOperationLocation   = "Operation-Location"
+	headerAzureAsyncOperation = "Azure-AsyncOperation"
+	headerLocation            = "Location"
+	headerRetryAfter          = "Retry-After"
+
+	defaultAsyncPollInterval    = 2 * time.Second
+	defaultAsyncMaxPollInterval = 30 * time.Second
+)
+
+// asyncPollLocationHeaders are the response headers that may point to
+// the status monitor of a long-running operation, in order of preference.
+var asyncPollLocationHeaders = []string{headerOperationLocation, headerAzureAsyncOperation, headerLocation}
+
+var (
+	defaultAsyncStatusProperties = []string{"status", "state", "provisioningState"}
+	defaultAsyncSucceededValues  = []string{"succeeded", "success", "successful", "completed", "complete", "done", "ready", "active"}
+	defaultAsyncFailedValues     = []string{"failed", "failure", "error", "canceled", "cancelled"}
+	// asyncOperationResultProperties are the properties of an operation
+	// resource that may contain the resource affected by the operation.
+	asyncOperationResultProperties = []string{"response", "result"}
+)
+
+// AsyncOperationHint describes how the mutating operations of a resource
+// complete asynchronously.
+type AsyncOperationHint struct {
+	// PollEndpoint is the OpenAPI path of the operation resource to poll
+	// when the API does not return its location in a response header.
+	// Path params are resolved from the response body of the request
+	// that started the operation.
+	PollEndpoint *string `json:"pollEndpoint,omitempty"`
+	// StatusProperty is the property of the operation resource that holds
+	// its status. The properties `status`, `state` and `provisioningState`
+	// are looked up if this is empty.
+	StatusProperty string `json:"statusProperty,omitempty"`
+	// SucceededValues are the status values that indicate success.
+	SucceededValues []string `json:"succeededValues,omitempty"`
+	// FailedValues are the status values that indicate failure.
+	FailedValues []string `json:"failedValues,omitempty"`
+}
+
+// asyncOperation is a long-running operation that was accepted by the API
+// but had not completed when its response was returned.
+type asyncOperation struct {
+	hint AsyncOperationHint
+
+	newPollRequest func(ctx context.Context) (*http.Request, error)
+	// pollURL is the URL of the poll endpoint unless the operation
+	// reads the resource.
+	pollURL string
+
+	// readsResource is true when the operation is tracked by polling
+	// the resource's read endpoint instead of an operation resource.
+	readsResource bool
+	// pendingOnNotFound is true when a 404 from the poll endpoint
+	// means that the operation has not completed yet.
+	pendingOnNotFound bool
+	// completeOnNotFound is true when a 404 from the poll endpoint
+	// means that the operation has completed, i.e. the resource
+	// was deleted.
+	completeOnNotFound bool
+	// isNotFound overrides how a response of the poll endpoint is
+	// determined to be a 404.
+	isNotFound func(statusCode int, body []byte) bool
+
+	// lastResource is the resource in the last successful response of
+	// the poll endpoint if the operation reads the resource.
+	lastResource map[string]interface{}
+}
+
+// getAsyncOperation returns the long-running operation started by httpReq.
+// The operation is detected from the response headers, the OpenAPI links
+// of the 202 response, or the async operation hint in the metadata.
+// If none of those are available but the operation declares callbacks or
+// the resource has a hint, the resource's read endpoint is polled instead.
+// Returns nil if the response does not represent an async operation.
+func (p *Provider) getAsyncOperation(resourceTypeToken string, httpReq *http.Request, httpResp *http.Response, body map[string]interface{}, readReq func(ctx context.Context) (*http.Request, error)) (*asyncOperation, error) {
+	if httpResp.StatusCode != http.StatusAccepted {
+		return nil, nil
+	}
+
+	hint, hasHint := p.frameworkMetadata.AsyncOperationMap[resourceTypeToken]
+	op := &asyncOperation{hint: hint}
+
+	for _, header := range asyncPollLocationHeaders {
+		location := httpResp.Header.Get(header)
+		if location == "" {
+			continue
+		}
+
+		pollURL, err := httpReq.URL.Parse(location)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing %s header", header)
+		}
+
+		logging.V(3).Infof("Async operation will be polled using the %s header: %s", header, redactURL(pollURL))
+		op.pollURL = pollURL.String()
+
+		// The poll endpoint is authenticated like the operation of the
+		// OpenAPI doc that it matches, if any, but credentials are never
+		// sent to another host that the API points to.
+		security := p.getDocSecurityRequirements()
+		if pollPath, ok := p.findRoutePath(op.pollURL); ok {
+			security = p.getSecurityRequirements(pollPath, http.MethodGet)
+		}
+		if pollURL.Host != httpReq.URL.Host {
+			security = openapi3.SecurityRequirements{}
+		}
+		op.newPollRequest = p.newAsyncPollRequestFunc(op.pollURL, security)
+		return op, nil
+	}
+
+	route, pathParams, err := p.config().router.FindRoute(httpReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding route from router")
+	}
+
+	if hasHint && hint.PollEndpoint != nil {
+		pollPath, err := resolveAsyncPollPath(*hint.PollEndpoint, nil, pathParams, httpResp, body)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolving async poll endpoint %s", *hint.PollEndpoint)
+		}
+
+		op.pollURL = p.getServerURL(*hint.PollEndpoint, http.MethodGet) + pollPath
+		op.newPollRequest = p.newAsyncPollRequestFunc(op.pollURL, p.getSecurityRequirements(*hint.PollEndpoint, http.MethodGet))
+		return op, nil
+	}
+
+	endpointPath, pollPath, ok, err := p.getAsyncPollPathFromLinks(route.Operation, pathParams, httpResp, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolving async poll endpoint from response links")
+	}
+	if ok {
+		op.pollURL = p.getServerURL(endpointPath, http.MethodGet) + pollPath
+		op.newPollRequest = p.newAsyncPollRequestFunc(op.pollURL, p.getSecurityRequirements(endpointPath, http.MethodGet))
+		return op, nil
+	}
+
+	if readReq != nil && (hasHint || len(route.Operation.Callbacks) > 0) {
+		logging.V(3).Info("Async operation does not have a status monitor. Will poll the resource instead...")
+		op.newPollRequest = readReq
+		op.readsResource = true
+		return op, nil
+	}
+
+	logging.V(3).Infof("Response for %s %s was accepted but the async operation cannot be tracked", httpReq.Method, redactURL(httpReq.URL))
+	return nil, nil
+}
+
+// newAsyncPollRequestFunc returns a func that creates GET requests for
+// pollURL, which are authenticated with the security requirements of the
+// poll endpoint.
+func (p *Provider) newAsyncPollRequestFunc(pollURL string, security openapi3.SecurityRequirements) func(ctx context.Context) (*http.Request, error) {
+	return func(ctx context.Context) (*http.Request, error) {
+		pollReq, err := http.NewRequestWithContext(ctx, http.MethodGet, pollURL, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "initializing poll request")
+		}
+
+		if err := p.authenticate(ctx, pollReq, security); err != nil {
+			return nil, err
+		}
+		pollReq.Header.Add("Accept", jsonMimeType)
+
+		return pollReq, nil
+	}
+}
+
+// getAsyncPollPathFromLinks returns the API path of the operation that the
+// links of the operation's 202 response point to, and that path with its
+// path params resolved.
+func (p *Provider) getAsyncPollPathFromLinks(operation *openapi3.Operation, pathParams map[string]string, httpResp *http.Response, body map[string]interface{}) (string, string, bool, error) {
+	if operation == nil || operation.Responses == nil {
+		return "", "", false, nil
+	}
+
+	responseRef := operation.Responses.Status(http.StatusAccepted)
+	if responseRef == nil || responseRef.Value == nil || len(responseRef.Value.Links) == 0 {
+		return "", "", false, nil
+	}
+
+	linkNames := slices.Collect(maps.Keys(responseRef.Value.Links))
+	sort.Strings(linkNames)
+
+	for _, name := range linkNames {
+		linkRef := responseRef.Value.Links[name]
+		if linkRef == nil || linkRef.Value == nil {
+			continue
+		}
+
+		endpointPath, ok := p.findGetEndpointForLink(linkRef.Value)
+		if !ok {
+			continue
+		}
+
+		pollPath, err := resolveAsyncPollPath(endpointPath, linkRef.Value.Parameters, pathParams, httpResp, body)
+		if err != nil {
+			return "", "", false, errors.Wrapf(err, "resolving link %s", name)
+		}
+
+		logging.V(3).Infof("Async operation will be polled using the response link %s: %s", name, pollPath)
+		return endpointPath, pollPath, true, nil
+	}
+
+	return "", "", false, nil
+}
+
+// findGetEndpointForLink returns the path of the GET operation that a
+// response link refers to.
+func (p *Provider) findGetEndpointForLink(link *openapi3.Link) (string, bool) {
+	if link.OperationID != "" {
+		for endpointPath, pathItem := range p.openAPIDoc.Paths.Map() {
+			if pathItem.Get != nil && pathItem.Get.OperationID == link.OperationID {
+				return endpointPath, true
+			}
+		}
+		return "", false
+	}
+
+	// Only local operation references of the form
+	// `#/paths/~1operations~1{id}/get` are supported.
+	ref := strings.TrimPrefix(link.OperationRef, "#/paths/")
+	if ref == link.OperationRef || !strings.HasSuffix(ref, "/get") {
+		return "", false
+	}
+
+	endpointPath := unescapeJSONPointerToken(strings.TrimSuffix(ref, "/get"))
+	if p.openAPIDoc.Paths.Find(endpointPath) == nil {
+		return "", false
+	}
+
+	return endpointPath, true
+}
+
+// resolveAsyncPollPath replaces the path params in endpointPath. Params
+// are resolved from the link parameters first, then the path params of
+// the request that started the operation and finally the response body.
+func resolveAsyncPollPath(endpointPath string, linkParams map[string]any, pathParams map[string]string, httpResp *http.Response, body map[string]interface{}) (string, error) {
+	resolved := endpointPath
+	for _, segment := range strings.Split(endpointPath, pathSeparator) {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+
+		paramName := strings.Trim(segment, "{}")
+		var value string
+		var ok bool
+		if expr, exists := linkParams[paramName]; exists {
+			value, ok = evaluateRuntimeExpression(expr, pathParams, httpResp, body)
+		} else if v, exists := pathParams[paramName]; exists {
+			value, ok = v, true
+		} else if v, exists := body[paramName]; exists && v != nil {
+			value, ok = convertNumericIDToString(v), true
+		}
+
+		if !ok {
+			return "", errors.Errorf("did not find value for path param %s", paramName)
+		}
+
+		resolved = strings.ReplaceAll(resolved, segment, url.PathEscape(value))
+	}
+
+	return resolved, nil
+}
+
+// evaluateRuntimeExpression evaluates the subset of OpenAPI runtime
+// expressions that can be resolved from the response of the request
+// that started an async operation.
+func evaluateRuntimeExpression(expr any, pathParams map[string]string, httpResp *http.Response, body map[string]interface{}) (string, bool) {
+	s, ok := expr.(string)
+	if !ok {
+		return fmt.Sprintf("%v", expr), true
+	}
+
+	switch {
+	case strings.HasPrefix(s, "$response.header."):
+		v := httpResp.Header.Get(strings.TrimPrefix(s, "$response.header."))
+		return v, v != ""
+	case strings.HasPrefix(s, "$response.body#"):
+		v, ok := lookupJSONPointer(body, strings.TrimPrefix(s, "$response.body#"))
+		if !ok || v == nil {
+			return "", false
+		}
+		return convertNumericIDToString(v), true
+	case strings.HasPrefix(s, "$request.path."):
+		v, ok := pathParams[strings.TrimPrefix(s, "$request.path.")]
+		return v, ok
+	case strings.HasPrefix(s, "$"):
+		return "", false
+	default:
+		return s, true
+	}
+}
+
+// lookupJSONPointer returns the value that the JSON pointer refers to in v.
+func lookupJSONPointer(v interface{}, pointer string) (interface{}, bool) {
+	if pointer == "" {
+		return v, true
+	}
+
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = unescapeJSONPointerToken(token)
+		switch val := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = val[token]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(val) {
+				return nil, false
+			}
+			v = val[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+func unescapeJSONPointerToken(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}
+
+// pollAsyncOperation polls the operation with backoff until it reaches a
+// terminal state or ctx is done. Returns the last response body of the
+// poll endpoint, if any.
+func (p *Provider) pollAsyncOperation(ctx context.Context, op *asyncOperation) (map[string]interface{}, error) {
+	interval := p.asyncPollInterval
+
+	for {
+		pollReq, err := op.newPollRequest(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "creating poll request")
+		}
+
+		pollResp, err := p.httpClient.Do(pollReq)
+		if err != nil {
+			return nil, errors.Wrap(err, "executing poll request")
+		}
+
+		body, err := io.ReadAll(pollResp.Body)
+		pollResp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "reading poll response body")
+		}
+
+		if op.readsResource && pollResp.StatusCode == http.StatusOK {
+			var lastResource map[string]interface{}
+			if json.Unmarshal(body, &lastResource) == nil {
+				op.lastResource = lastResource
+			}
+		}
+
+		done, result, err := op.evaluate(pollResp, body)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			logging.V(3).Infof("Async operation completed (status: %s)", pollResp.Status)
+			return result, nil
+		}
+
+		wait := interval
+		if retryAfter, ok := parseRetryAfter(pollResp.Header.Get(headerRetryAfter), time.Now()); ok {
+			wait = retryAfter
+		}
+
+		logging.V(3).Infof("Async operation is still in progress. Polling again after %v...", wait)
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "waiting for async operation to complete")
+		case <-time.After(wait):
+		}
+
+		interval = min(interval*2, p.asyncMaxPollInterval)
+	}
+}
+
+// evaluate returns true if the poll response indicates that the operation
+// has completed successfully. An error is returned if the operation failed.
+func (op *asyncOperation) evaluate(pollResp *http.Response, body []byte) (bool, map[string]interface{}, error) {
+	notFound := pollResp.StatusCode == http.StatusNotFound
+	if op.isNotFound != nil {
+		notFound = op.isNotFound(pollResp.StatusCode, body)
+	}
+
+	switch {
+	case notFound && op.completeOnNotFound:
+		return true, nil, nil
+	case notFound && op.pendingOnNotFound:
+		return false, nil, nil
+	case pollResp.StatusCode == http.StatusAccepted:
+		return false, nil, nil
+	case pollResp.StatusCode < http.StatusOK || pollResp.StatusCode >= http.StatusMultipleChoices:
+		return false, nil, errors.Wrap(newAPIErrorFromResponse(pollResp.Request, pollResp, body), "polling async operation")
+	case op.completeOnNotFound:
+		// The resource still exists.
+		return false, nil, nil
+	}
+
+	var result map[string]interface{}
+	if len(body) == 0 || json.Unmarshal(body, &result) != nil {
+		return true, nil, nil
+	}
+
+	// Operations modelled after Google's long-running operations
+	// have a boolean `done` property and an `error` once done.
+	if done, ok := result["done"].(bool); ok {
+		if !done {
+			return false, nil, nil
+		}
+		if opErr, ok := result["error"]; ok && opErr != nil {
+			return false, nil, errors.Errorf("async operation failed: %v", opErr)
+		}
+		return true, result, nil
+	}
+
+	status, ok := op.getStatus(result)
+	if !ok {
+		return true, result, nil
+	}
+
+	failedValues := op.hint.FailedValues
+	if len(failedValues) == 0 {
+		failedValues = defaultAsyncFailedValues
+	}
+	if containsFold(failedValues, status) {
+		return false, nil, errors.Errorf("async operation failed with status %q: %s", status, string(body))
+	}
+
+	succeededValues := op.hint.SucceededValues
+	if len(succeededValues) == 0 {
+		succeededValues = defaultAsyncSucceededValues
+	}
+	if containsFold(succeededValues, status) {
+		return true, result, nil
+	}
+
+	logging.V(3).Infof("Async operation status is %q", status)
+	return false, nil, nil
+}
+
+// getStatus returns the status of the operation from the poll response.
+func (op *asyncOperation) getStatus(result map[string]interface{}) (string, bool) {
+	statusProperties := defaultAsyncStatusProperties
+	if op.hint.StatusProperty != "" {
+		statusProperties = []string{op.hint.StatusProperty}
+	}
+
+	for _, propName := range statusProperties {
+		if strings.Contains(propName, ".") {
+			v, ok := lookupJSONPointer(result, "/"+strings.ReplaceAll(propName, ".", "/"))
+			if s, isString := v.(string); ok && isString {
+				return s, true
+			}
+			continue
+		}
+
+		if v, ok := result[propName].(string); ok {
+			return v, true
+		}
+
+		// Some APIs nest the status under a `properties` object.
+		if nested, ok := result["properties"].(map[string]interface{}); ok {
+			if v, ok := nested[propName].(string); ok {
+				return v, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func containsFold(values []string, s string) bool {
+	return slices.ContainsFunc(values, func(v string) bool {
+		return strings.EqualFold(v, s)
+	})
+}
+
+// awaitAsyncResourceOperation waits for the async operation started by
+// httpReq to complete and returns the final state of the resource read
+// from its read endpoint. The outputs are returned as-is if the response
+// does not represent an async operation.
+func (p *Provider) awaitAsyncResourceOperation(ctx context.Context, resourceTypeToken string, crudMap *providerGen.CRUDOperationsMap, httpReq *http.Request, httpResp *http.Response, inputs resource.PropertyMap, currentState resource.PropertyMap, outputs interface{}) (interface{}, error) {
+	outputsMap, ok := outputs.(map[string]interface{})
+	if !ok {
+		return outputs, nil
+	}
+
+	var readReq func(ctx context.Context) (*http.Request, error)
+	if crudMap.R != nil {
+		readReq = func(ctx context.Context) (*http.Request, error) {
+			m := currentState.Copy()
+			maps.Copy(m, resource.NewPropertyMapFromMap(outputsMap))
+			return p.CreateGetRequest(ctx, *crudMap.R, inputs, &m)
+		}
+	}
+
+	op, err := p.getAsyncOperation(resourceTypeToken, httpReq, httpResp, outputsMap, readReq)
+	if err != nil {
+		return nil, err
+	}
+	if op == nil {
+		return outputs, nil
+	}
+	op.pendingOnNotFound = op.readsResource
+
+	result, err := p.pollAsyncOperation(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+
+	if !op.readsResource {
+		hasResult := false
+		for _, propName := range asyncOperationResultProperties {
+			if v, ok := result[propName].(map[string]interface{}); ok {
+				maps.Copy(outputsMap, v)
+				hasResult = true
+				break
+			}
+		}
+
+		// APIs commonly respond with the URL of the new resource in the
+		// Location header, in which case the last poll response is the
+		// resource. It may be the only way to know the resource's ID if
+		// the 202 response does not have a body.
+		if !hasResult && result != nil && p.isResourceURL(op.pollURL, crudMap) {
+			return result, nil
+		}
+	} else if result != nil {
+		// The last poll response is the latest state of the resource.
+		return result, nil
+	}
+
+	if readReq == nil {
+		return outputsMap, nil
+	}
+
+	return p.readResourceOutputs(ctx, readReq)
+}
+
+// isResourceURL returns true if rawURL is routed to the read endpoint of
+// a resource.
+func (p *Provider) isResourceURL(rawURL string, crudMap *providerGen.CRUDOperationsMap) bool {
+	if crudMap.R == nil {
+		return false
+	}
+
+	apiPath, ok := p.findRoutePath(rawURL)
+	return ok && apiPath == *crudMap.R
+}
+
+// findRoutePath returns the API path of the OpenAPI doc whose GET
+// operation rawURL matches.
+func (p *Provider) findRoutePath(rawURL string) (string, bool) {
+	if rawURL == "" {
+		return "", false
+	}
+
+	httpReq, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", false
+	}
+
+	route, _, err := p.config().router.FindRoute(httpReq)
+	if err != nil {
+		return "", false
+	}
+
+	return route.Path, true
+}
+
+// awaitAsyncDeleteOperation waits for the async delete operation started
+// by httpReq to complete. Nothing is done if the response does not
+// represent an async operation.
+func (p *Provider) awaitAsyncDeleteOperation(ctx context.Context, resourceTypeToken string, crudMap *providerGen.CRUDOperationsMap, httpReq *http.Request, httpResp *http.Response, body []byte, inputs resource.PropertyMap, oldInputs resource.PropertyMap) error {
+	var bodyMap map[string]interface{}
+	if len(body) > 0 {
+		_ = json.Unmarshal(body, &bodyMap)
+	}
+
+	op, err := p.getAsyncOperation(resourceTypeToken, httpReq, httpResp, bodyMap, p.newDeletedResourceReadRequestFunc(crudMap, inputs, oldInputs))
+	if err != nil {
+		return err
+	}
+	if op == nil {
+		return nil
+	}
+	if op.readsResource {
+		op.completeOnNotFound = true
+		op.isNotFound = p.isResourceNotFoundFunc(resourceTypeToken)
+	}
+
+	_, err = p.pollAsyncOperation(ctx, op)
+	return err
+}
+
+// newDeletedResourceReadRequestFunc returns a func that creates requests
+// for the read endpoint of a resource that is being deleted.
+func (p *Provider) newDeletedResourceReadRequestFunc(crudMap *providerGen.CRUDOperationsMap, inputs resource.PropertyMap, oldInputs resource.PropertyMap) func(ctx context.Context) (*http.Request, error) {
+	if crudMap.R == nil {
+		return nil
+	}
+
+	return func(ctx context.Context) (*http.Request, error) {
+		m := oldInputs.Copy()
+		maps.Copy(m, inputs)
+		return p.CreateGetRequest(ctx, *crudMap.R, m, nil)
+	}
+}
+
+// readResourceOutputs reads the current state of a resource.
+func (p *Provider) readResourceOutputs(ctx context.Context, readReq func(ctx context.Context) (*http.Request, error)) (map[string]interface{}, error) {
+	httpReq, err := readReq(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating get request")
+	}
+
+	httpResp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "executing http request")
+	}
+
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading response body")
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, p.newAPIError(httpReq, httpResp, body)
+	}
+
+	var outputs map[string]interface{}
+	if err := json.Unmarshal(body, &outputs); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling the response")
+	}
+
+	return outputs, nil
+}
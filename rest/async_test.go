@@ -0,0 +1,363 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+
+	"github.com/cloudy-sky-software/pulumi-provider-framework/state"
+
+	"google.golang.org/grpc/status"
+)
+
+func TestCreateWaitsForAsyncOperation(t *testing.T) {
+	ctx := context.Background()
+
+	var pollCount atomic.Int32
+
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/fakeresource" && r.Method == http.MethodPost:
+			w.Header().Set(headerOperationLocation, "/operations/op-1")
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = io.WriteString(w, `{"id":"fake-id"}`)
+		case r.URL.Path == "/operations/op-1":
+			assert.NotEmpty(t, r.Header.Get("Authorization"), "Expected the poll request to be authenticated")
+			if pollCount.Add(1) < 3 {
+				_, _ = io.WriteString(w, `{"status":"running"}`)
+				return
+			}
+			_, _ = io.WriteString(w, `{"status":"succeeded"}`)
+		case r.URL.Path == fakeResourceURLPath:
+			_, _ = io.WriteString(w, `{"id":"fake-id","another_prop":"final value"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	p.(*Provider).asyncPollInterval = time.Millisecond
+
+	props, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(map[string]any{
+		"simpleProp": "somevalue",
+	}), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	createResp, err := p.Create(ctx, &pulumirpc.CreateRequest{
+		Name:       "myResource",
+		Properties: props,
+		Type:       "generic:fakeresource/v2:FakeResource",
+		Urn:        "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "fake-id", createResp.GetId())
+	assert.Equal(t, int32(3), pollCount.Load())
+	assert.Equal(t, "final value", createResp.GetProperties().AsMap()["anotherProp"])
+}
+
+func TestCreateReadsResourceFromLocationHeader(t *testing.T) {
+	ctx := context.Background()
+
+	var pollCount atomic.Int32
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/fakeresource":
+			// The ID of the resource is only known from the URL of the
+			// Location header.
+			w.Header().Set(headerLocation, fakeResourceURLPath)
+			w.WriteHeader(http.StatusAccepted)
+		case fakeResourceURLPath:
+			if pollCount.Add(1) < 2 {
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			_, _ = io.WriteString(w, `{"id":"fake-id","another_prop":"final value"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	p.(*Provider).asyncPollInterval = time.Millisecond
+
+	props, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(map[string]any{
+		"simpleProp": "somevalue",
+	}), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	createResp, err := p.Create(ctx, &pulumirpc.CreateRequest{
+		Name:       "myResource",
+		Properties: props,
+		Type:       "generic:fakeresource/v2:FakeResource",
+		Urn:        "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "fake-id", createResp.GetId())
+	assert.Equal(t, int32(2), pollCount.Load())
+	assert.Equal(t, "final value", createResp.GetProperties().AsMap()["anotherProp"])
+}
+
+func TestCreateFailsWhenAsyncOperationFails(t *testing.T) {
+	ctx := context.Background()
+
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/fakeresource":
+			w.Header().Set(headerLocation, "/operations/op-1")
+			w.WriteHeader(http.StatusAccepted)
+		case "/operations/op-1":
+			_, _ = io.WriteString(w, `{"done":true,"error":{"message":"quota exceeded"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	p.(*Provider).asyncPollInterval = time.Millisecond
+
+	props, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(map[string]any{
+		"simpleProp": "somevalue",
+	}), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	_, err = p.Create(ctx, &pulumirpc.CreateRequest{
+		Name:       "myResource",
+		Properties: props,
+		Type:       "generic:fakeresource/v2:FakeResource",
+		Urn:        "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "quota exceeded")
+}
+
+func TestAsyncOperationRespectsContextDeadline(t *testing.T) {
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/fakeresource":
+			w.Header().Set(headerOperationLocation, "/operations/op-1")
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = io.WriteString(w, `{"id":"fake-id"}`)
+		default:
+			_, _ = io.WriteString(w, `{"status":"running"}`)
+		}
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(context.Background(), t, testServer, nil)
+	p.(*Provider).asyncPollInterval = time.Millisecond
+	p.(*Provider).asyncMaxPollInterval = 5 * time.Millisecond
+
+	props, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(map[string]any{
+		"simpleProp": "somevalue",
+	}), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = p.Create(ctx, &pulumirpc.CreateRequest{
+		Name:       "myResource",
+		Properties: props,
+		Type:       "generic:fakeresource/v2:FakeResource",
+		Urn:        "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+
+	// The resource was created so it is still reported.
+	initErr := requireResourceInitFailed(t, err)
+	assert.Equal(t, "fake-id", initErr.GetId())
+}
+
+func TestCreateReportsResourceWhenAsyncOperationFails(t *testing.T) {
+	ctx := context.Background()
+
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/fakeresource":
+			w.Header().Set(headerOperationLocation, "/operations/op-1")
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = io.WriteString(w, `{"id":"fake-id","another_prop":"initial value"}`)
+		case "/operations/op-1":
+			_, _ = io.WriteString(w, `{"status":"failed"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	p.(*Provider).asyncPollInterval = time.Millisecond
+
+	props, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(map[string]any{
+		"simpleProp": "somevalue",
+	}), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	_, err = p.Create(ctx, &pulumirpc.CreateRequest{
+		Name:       "myResource",
+		Properties: props,
+		Type:       "generic:fakeresource/v2:FakeResource",
+		Urn:        "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
+	})
+	require.Error(t, err)
+
+	initErr := requireResourceInitFailed(t, err)
+	assert.Equal(t, "fake-id", initErr.GetId())
+	assert.Equal(t, "initial value", initErr.GetProperties().AsMap()["anotherProp"])
+	require.Len(t, initErr.GetReasons(), 1)
+	assert.Contains(t, initErr.GetReasons()[0], "waiting for the resource to be created")
+}
+
+// requireResourceInitFailed returns the ErrorResourceInitFailed detail of
+// an error returned by the provider.
+func requireResourceInitFailed(t *testing.T, err error) *pulumirpc.ErrorResourceInitFailed {
+	t.Helper()
+
+	s, ok := status.FromError(err)
+	require.True(t, ok, "expected a gRPC status error: %v", err)
+	for _, detail := range s.Details() {
+		if initErr, ok := detail.(*pulumirpc.ErrorResourceInitFailed); ok {
+			return initErr
+		}
+	}
+
+	require.FailNow(t, "expected the error to have an ErrorResourceInitFailed detail", err.Error())
+	return nil
+}
+
+func TestResolveAsyncPollPathFromRuntimeExpressions(t *testing.T) {
+	httpResp := &http.Response{Header: http.Header{}}
+	httpResp.Header.Set("X-Operation-Id", "op-42")
+
+	body := map[string]interface{}{
+		"operation": map[string]interface{}{"name": "op-1"},
+	}
+
+	pollPath, err := resolveAsyncPollPath("/v2/{baseId}/operations/{operationId}", map[string]any{
+		"operationId": "$response.body#/operation/name",
+	}, map[string]string{"baseId": "base"}, httpResp, body)
+	require.NoError(t, err)
+	assert.Equal(t, "/v2/base/operations/op-1", pollPath)
+
+	pollPath, err = resolveAsyncPollPath("/operations/{operationId}", map[string]any{
+		"operationId": "$response.header.X-Operation-Id",
+	}, nil, httpResp, body)
+	require.NoError(t, err)
+	assert.Equal(t, "/operations/op-42", pollPath)
+
+	_, err = resolveAsyncPollPath("/operations/{operationId}", nil, nil, httpResp, body)
+	assert.Error(t, err)
+}
+
+func TestAsyncPollUsesServersAndSecurityOfPollOperation(t *testing.T) {
+	ctx := context.Background()
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/fakeresource" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = io.WriteString(w, `{"id":"fake-id","resourceId":"fake-id"}`)
+	}))
+	defer apiServer.Close()
+
+	var pollCount atomic.Int32
+	pollServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"), "Expected the poll request of an operation without security not to be authenticated")
+		if r.URL.Path != fakeResourceURLPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		pollCount.Add(1)
+		_, _ = io.WriteString(w, `{"id":"fake-id","another_prop":"final value"}`)
+	}))
+	defer pollServer.Close()
+
+	pollEndpoint := "/v2/fakeresource/{resourceId}"
+	p := makeTestGenericProvider(ctx, t, nil, nil)
+	p.(*Provider).asyncPollInterval = time.Millisecond
+	p.(*Provider).frameworkMetadata.AsyncOperationMap = map[string]AsyncOperationHint{
+		fakeResourceTypeToken: {PollEndpoint: &pollEndpoint},
+	}
+	setReadSecurity(p, openapi3.SecurityRequirements{})
+	p.(*Provider).openAPIDoc.Paths.Find("/v2/fakeresource/{resourceId}").Get.Servers = &openapi3.Servers{{URL: pollServer.URL}}
+	require.NoError(t, configureTestServers(ctx, t, p, openapi3.Servers{{URL: apiServer.URL}}, nil))
+
+	props, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(map[string]any{
+		"simpleProp": "somevalue",
+	}), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	createResp, err := p.Create(ctx, &pulumirpc.CreateRequest{
+		Name:       "myResource",
+		Properties: props,
+		Type:       fakeResourceTypeToken,
+		Urn:        fakeResourceURN,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), pollCount.Load())
+	assert.Equal(t, "final value", createResp.GetProperties().AsMap()["anotherProp"])
+}
+
+func TestAsyncPollOfLocationHeaderUsesSecurityOfMatchingOperation(t *testing.T) {
+	ctx := context.Background()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/fakeresource":
+			w.Header().Set(headerLocation, fakeResourceURLPath)
+			w.WriteHeader(http.StatusAccepted)
+		case fakeResourceURLPath:
+			assert.Empty(t, r.Header.Get("Authorization"), "Expected the poll request of an operation without security not to be authenticated")
+			_, _ = io.WriteString(w, `{"id":"fake-id","another_prop":"final value"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	p.(*Provider).asyncPollInterval = time.Millisecond
+	setReadSecurity(p, openapi3.SecurityRequirements{})
+
+	props, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(map[string]any{
+		"simpleProp": "somevalue",
+	}), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	createResp, err := p.Create(ctx, &pulumirpc.CreateRequest{
+		Name:       "myResource",
+		Properties: props,
+		Type:       fakeResourceTypeToken,
+		Urn:        fakeResourceURN,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "final value", createResp.GetProperties().AsMap()["anotherProp"])
+}
@@ -0,0 +1,318 @@
+package rest
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/pkg/errors"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/logging"
+)
+
+const (
+	securitySchemeTypeAPIKey        = "apikey"
+	securitySchemeTypeHTTP          = "http"
+	securitySchemeTypeOAuth2        = "oauth2"
+	securitySchemeTypeOpenIDConnect = "openidconnect"
+)
+
+// Authenticator adds the provider's credentials to the requests sent to
+// the API.
+type Authenticator interface {
+	// Authenticate adds credentials to httpReq, which is otherwise fully
+	// built. security are the security requirements of the request's
+	// operation, or of the OpenAPI doc if the operation has none.
+	// Authenticate can be called again for a request that already has
+	// credentials, e.g. for the next page of a list, so it must replace
+	// them instead of adding to them.
+	Authenticate(ctx context.Context, httpReq *http.Request, security openapi3.SecurityRequirements) error
+}
+
+// CredentialFunc returns a credential, such as an API key, when a request
+// is authenticated, so that it can be read from the provider config once
+// the provider is configured.
+type CredentialFunc func() string
+
+// StaticCredential returns a CredentialFunc that always returns credential.
+func StaticCredential(credential string) CredentialFunc {
+	return func() string {
+		return credential
+	}
+}
+
+// APIKeyAuthenticator sends an API key in a header, a query param or a
+// cookie.
+type APIKeyAuthenticator struct {
+	// In is where the API key is sent: `header`, `query` or `cookie`.
+	// Defaults to `header`.
+	In string
+	// Name is the name of the header, query param or cookie.
+	Name string
+	// Key returns the API key.
+	Key CredentialFunc
+}
+
+// Authenticate implements Authenticator.
+func (a *APIKeyAuthenticator) Authenticate(_ context.Context, httpReq *http.Request, _ openapi3.SecurityRequirements) error {
+	key := a.Key()
+	if key == "" {
+		return errors.Errorf("api key %s is not set", a.Name)
+	}
+
+	switch a.In {
+	case "", openapi3.ParameterInHeader:
+		httpReq.Header.Set(a.Name, key)
+	case openapi3.ParameterInQuery:
+		query := httpReq.URL.Query()
+		query.Set(a.Name, key)
+		httpReq.URL.RawQuery = query.Encode()
+	case openapi3.ParameterInCookie:
+		setCookie(httpReq, &http.Cookie{Name: a.Name, Value: key})
+	default:
+		return errors.Errorf("unknown api key location %q", a.In)
+	}
+
+	return nil
+}
+
+// BasicAuthenticator sends a username and password with HTTP basic
+// authentication.
+type BasicAuthenticator struct {
+	Username CredentialFunc
+	Password CredentialFunc
+}
+
+// Authenticate implements Authenticator.
+func (a *BasicAuthenticator) Authenticate(_ context.Context, httpReq *http.Request, _ openapi3.SecurityRequirements) error {
+	httpReq.SetBasicAuth(a.Username(), a.Password())
+	return nil
+}
+
+// BearerAuthenticator sends a token in the Authorization header.
+type BearerAuthenticator struct {
+	Token CredentialFunc
+}
+
+// Authenticate implements Authenticator.
+func (a *BearerAuthenticator) Authenticate(_ context.Context, httpReq *http.Request, _ openapi3.SecurityRequirements) error {
+	token := a.Token()
+	if token == "" {
+		return errors.New("bearer token is not set")
+	}
+
+	httpReq.Header.Set(headerAuthorization, bearerAuthSchemePrefix+" "+token)
+	return nil
+}
+
+// callbackAuthenticator sends the authorization header returned by the
+// provider callback with the security scheme of the request's operation.
+// It is used unless the provider has another authenticator.
+type callbackAuthenticator struct {
+	p *Provider
+}
+
+// Authenticate implements Authenticator.
+func (a callbackAuthenticator) Authenticate(ctx context.Context, httpReq *http.Request, security openapi3.SecurityRequirements) error {
+	value := a.p.providerCallback.GetAuthorizationHeader()
+	if value == "" {
+		return nil
+	}
+
+	schemes := a.p.getSecuritySchemes(security)
+	if len(schemes) == 0 {
+		httpReq.Header.Set(headerAuthorization, value)
+		return nil
+	}
+
+	for _, scheme := range schemes {
+		if !strings.EqualFold(scheme.Type, securitySchemeTypeAPIKey) {
+			httpReq.Header.Set(headerAuthorization, value)
+			continue
+		}
+
+		apiKey := &APIKeyAuthenticator{In: scheme.In, Name: scheme.Name, Key: StaticCredential(value)}
+		if err := apiKey.Authenticate(ctx, httpReq, security); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getSecuritySchemes returns the security schemes with which a request is
+// authenticated by the provider callback. They are all the schemes, by
+// name, of the first of the security requirements, since a request must
+// satisfy every scheme of a requirement, or, if there are none, the first
+// scheme of the OpenAPI doc.
+func (p *Provider) getSecuritySchemes(security openapi3.SecurityRequirements) []*openapi3.SecurityScheme {
+	schemes := p.openAPIDoc.Components.SecuritySchemes
+
+	var result []*openapi3.SecurityScheme
+	if len(security) > 0 {
+		for _, name := range slices.Sorted(maps.Keys(security[0])) {
+			if ref := schemes[name]; ref != nil && ref.Value != nil {
+				result = append(result, ref.Value)
+			}
+		}
+
+		return result
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(schemes)) {
+		if ref := schemes[name]; ref != nil && ref.Value != nil {
+			return append(result, ref.Value)
+		}
+	}
+
+	return nil
+}
+
+// getAuthenticator returns the authenticator of the provider, which is
+// the one set with WithAuthenticator, or else the OAuth2 authenticator of
+// the provider config, or else the provider callback.
+func (p *Provider) getAuthenticator() Authenticator {
+	if p.authenticator != nil {
+		return p.authenticator
+	}
+
+	if a := p.config().oauth2Authenticator; a != nil {
+		return a
+	}
+
+	return callbackAuthenticator{p: p}
+}
+
+// getSecurityRequirements returns the security requirements of an
+// operation, which are those of the OpenAPI doc unless the operation
+// overrides them. They are empty but not nil if the operation declares
+// `security: []`, i.e. that it doesn't require authentication.
+func (p *Provider) getSecurityRequirements(apiPath, method string) openapi3.SecurityRequirements {
+	if pathItem := p.openAPIDoc.Paths.Find(apiPath); pathItem != nil {
+		if op := pathItem.GetOperation(method); op != nil && op.Security != nil {
+			if len(*op.Security) == 0 {
+				return openapi3.SecurityRequirements{}
+			}
+			return *op.Security
+		}
+	}
+
+	return p.getDocSecurityRequirements()
+}
+
+// getDocSecurityRequirements returns the security requirements of the
+// OpenAPI doc, or nil if it has none.
+func (p *Provider) getDocSecurityRequirements() openapi3.SecurityRequirements {
+	if len(p.openAPIDoc.Security) == 0 {
+		return nil
+	}
+
+	return p.openAPIDoc.Security
+}
+
+// authenticate adds the provider's credentials to a request unless its
+// operation doesn't require authentication.
+func (p *Provider) authenticate(ctx context.Context, httpReq *http.Request, security openapi3.SecurityRequirements) error {
+	if security != nil && len(security) == 0 {
+		logging.V(3).Infof("%s %s does not require authentication", httpReq.Method, redactURL(httpReq.URL))
+		return nil
+	}
+
+	if err := p.getAuthenticator().Authenticate(ctx, httpReq, security); err != nil {
+		return errors.Wrap(err, "authenticating request")
+	}
+
+	return nil
+}
+
+// validateSecurityScheme returns an error if a request isn't
+// authenticated with a security scheme. It is called by the request
+// validation for each scheme of a security requirement.
+func validateSecurityScheme(httpReq *http.Request, scheme *openapi3.SecurityScheme) error {
+	switch strings.ToLower(scheme.Type) {
+	case securitySchemeTypeAPIKey:
+		return checkAPIKey(httpReq, scheme)
+	case securitySchemeTypeHTTP:
+		return checkAuthorizationHeader(httpReq, scheme.Scheme)
+	case securitySchemeTypeOAuth2, securitySchemeTypeOpenIDConnect:
+		return checkAuthorizationHeader(httpReq, bearerAuthSchemePrefix)
+	default:
+		return nil
+	}
+}
+
+// checkAuthorizationHeader returns an error if a request doesn't have an
+// Authorization header with credentials of the given auth scheme.
+func checkAuthorizationHeader(httpReq *http.Request, authScheme string) error {
+	value := httpReq.Header.Get(headerAuthorization)
+	if value == "" {
+		return errors.Errorf("authorization header %s is required", headerAuthorization)
+	}
+
+	prefix, credentials, _ := strings.Cut(value, " ")
+	if !strings.EqualFold(prefix, authScheme) {
+		return errors.Errorf("unexpected auth scheme (expected %s)", newTitleCaser().String(authScheme))
+	}
+
+	if strings.TrimSpace(credentials) == "" {
+		return errors.New("auth token is required")
+	}
+
+	return nil
+}
+
+// checkAPIKey returns an error if a request doesn't have the API key of
+// an apiKey security scheme.
+func checkAPIKey(httpReq *http.Request, scheme *openapi3.SecurityScheme) error {
+	var key string
+	switch scheme.In {
+	case openapi3.ParameterInQuery:
+		key = httpReq.URL.Query().Get(scheme.Name)
+	case openapi3.ParameterInCookie:
+		if cookie, err := httpReq.Cookie(scheme.Name); err == nil {
+			key = cookie.Value
+		}
+	default:
+		key = httpReq.Header.Get(scheme.Name)
+	}
+
+	if key == "" {
+		return errors.Errorf("api key %s is required in %s", scheme.Name, scheme.In)
+	}
+
+	return nil
+}
+
+// redactURL returns a URL for logging and error messages with the values
+// of its query params and its password redacted, since an authenticator
+// can send credentials in the query.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	if redacted.RawQuery != "" {
+		query := redacted.Query()
+		for name := range query {
+			query[name] = []string{"xxxxx"}
+		}
+		redacted.RawQuery = query.Encode()
+	}
+
+	return redacted.Redacted()
+}
+
+// setCookie sets a cookie of a request, replacing any cookie with the
+// same name.
+func setCookie(httpReq *http.Request, cookie *http.Cookie) {
+	cookies := httpReq.Cookies()
+	httpReq.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != cookie.Name {
+			httpReq.AddCookie(c)
+		}
+	}
+
+	httpReq.AddCookie(cookie)
+}
@@ -0,0 +1,44 @@
+package rest
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// withCancellation returns a context that is done when ctx is done or
+// when the provider is cancelled by the engine.
+func (p *Provider) withCancellation(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(p.cancelCtx, cancel)
+
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// canceledError returns an error with the gRPC code Canceled if err
+// occurred after the provider was cancelled, so that the engine reports
+// the operation as aborted instead of failed. Otherwise, err is returned
+// as-is. The details of err are kept so that a resource that was created
+// before the cancellation is still reported with its ID and state.
+func (p *Provider) canceledError(err error) error {
+	if err == nil || p.cancelCtx.Err() == nil {
+		return err
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return status.Errorf(codes.Canceled, "operation canceled: %v", err)
+	}
+	if s.Code() == codes.Canceled {
+		return err
+	}
+
+	canceled := s.Proto()
+	canceled.Code = int32(codes.Canceled)
+	canceled.Message = "operation canceled: " + s.Message()
+	return status.FromProto(canceled).Err()
+}
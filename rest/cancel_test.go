@@ -0,0 +1,138 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pbempty "google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+
+	"github.com/cloudy-sky-software/pulumi-provider-framework/state"
+)
+
+func TestCancelAbortsRetryWait(t *testing.T) {
+	ctx := context.Background()
+
+	requested := make(chan struct{})
+	var once sync.Once
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		once.Do(func() { close(requested) })
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+
+	go func() {
+		<-requested
+		_, _ = p.Cancel(ctx, &pbempty.Empty{})
+	}()
+
+	start := time.Now()
+	_, err := p.Read(ctx, &pulumirpc.ReadRequest{
+		Id:  "/fake-id",
+		Urn: "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.Canceled, status.Code(err))
+	assert.Less(t, time.Since(start), time.Minute)
+}
+
+func TestCancelAbortsAsyncOperationPolling(t *testing.T) {
+	ctx := context.Background()
+
+	polled := make(chan struct{})
+	var once sync.Once
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/fakeresource":
+			w.Header().Set(headerOperationLocation, "/operations/op-1")
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = io.WriteString(w, `{"id":"fake-id"}`)
+		default:
+			once.Do(func() { close(polled) })
+			_, _ = io.WriteString(w, `{"status":"running"}`)
+		}
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	p.(*Provider).asyncPollInterval = time.Millisecond
+
+	props, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(map[string]any{
+		"simpleProp": "somevalue",
+	}), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	go func() {
+		<-polled
+		_, _ = p.Cancel(ctx, &pbempty.Empty{})
+	}()
+
+	_, err = p.Create(ctx, &pulumirpc.CreateRequest{
+		Name:       "myResource",
+		Properties: props,
+		Type:       fakeResourceTypeToken,
+		Urn:        "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.Canceled, status.Code(err))
+
+	// The resource was created before the cancellation so it is still
+	// reported.
+	initErr := requireResourceInitFailed(t, err)
+	assert.Equal(t, "fake-id", initErr.GetId())
+}
+
+func TestOperationsFailAfterCancel(t *testing.T) {
+	ctx := context.Background()
+
+	var requested atomic.Bool
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requested.Store(true)
+		_, _ = io.WriteString(w, `{"id":"fake-id"}`)
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+
+	_, err := p.Cancel(ctx, &pbempty.Empty{})
+	require.NoError(t, err)
+
+	_, err = p.Read(ctx, &pulumirpc.ReadRequest{
+		Id:  "/fake-id",
+		Urn: "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.Canceled, status.Code(err))
+
+	_, err = createFakeResource(ctx, t, p, 0)
+	require.Error(t, err)
+	assert.Equal(t, codes.Canceled, status.Code(err))
+	s, _ := status.FromError(err)
+	assert.Empty(t, s.Details(), "Expected no resource to be reported since it was not created")
+
+	assert.False(t, requested.Load(), "Expected no request to be sent after the provider was cancelled")
+}
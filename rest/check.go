@@ -0,0 +1,448 @@
+package rest
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/pkg/errors"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/logging"
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+
+	providerGen "github.com/cloudy-sky-software/pulschema/pkg"
+)
+
+// checkStringFormatValidators are the string format validators used to
+// validate inputs in addition to the ones that kin-openapi registers by
+// default.
+var checkStringFormatValidators = map[string]openapi3.StringFormatValidator{
+	"email": openapi3.NewRegexpFormatValidator(openapi3.FormatOfStringForEmail),
+	"uuid":  openapi3.NewRegexpFormatValidator(openapi3.FormatOfStringForUUIDOfRFC4122),
+}
+
+// getCreateRequestSchema returns the request body schema of the operation
+// that creates a resource. It returns nil if the operation does not
+// declare a JSON request body.
+func (p *Provider) getCreateRequestSchema(crudMap *providerGen.CRUDOperationsMap) *openapi3.Schema {
+	if crudMap.C == nil {
+		return nil
+	}
+
+	pathItem := p.openAPIDoc.Paths.Find(*crudMap.C)
+	if pathItem == nil {
+		return nil
+	}
+
+	createOp := pathItem.Post
+	if createOp == nil {
+		createOp = pathItem.Put
+	}
+	if createOp == nil || createOp.RequestBody == nil || createOp.RequestBody.Value == nil {
+		return nil
+	}
+
+	mediaType := createOp.RequestBody.Value.Content.Get(jsonMimeType)
+	if mediaType == nil || mediaType.Schema == nil {
+		return nil
+	}
+
+	return mediaType.Schema.Value
+}
+
+// applyDefaults sets the default values declared by the request schema of
+// the resource's create operation for properties that are omitted from the
+// inputs, so that the inputs match the request that is sent to the API.
+func (p *Provider) applyDefaults(crudMap *providerGen.CRUDOperationsMap, inputs resource.PropertyMap) {
+	schema := p.getCreateRequestSchema(crudMap)
+	if schema == nil {
+		return
+	}
+
+	p.applyObjectDefaults(inputs, schema)
+}
+
+func (p *Provider) applyValueDefaults(value resource.PropertyValue, schema *openapi3.Schema) {
+	if schema == nil {
+		return
+	}
+
+	value, known := unwrapPropertyValue(value)
+	if !known {
+		return
+	}
+
+	switch {
+	case value.IsObject():
+		p.applyObjectDefaults(value.ObjectValue(), schema)
+	case value.IsArray():
+		if schema.Items == nil {
+			return
+		}
+		for _, item := range value.ArrayValue() {
+			p.applyValueDefaults(item, schema.Items.Value)
+		}
+	}
+}
+
+func (p *Provider) applyObjectDefaults(obj resource.PropertyMap, schema *openapi3.Schema) {
+	for _, apiName := range slices.Sorted(maps.Keys(schema.Properties)) {
+		propSchemaRef := schema.Properties[apiName]
+		if propSchemaRef.Value == nil {
+			continue
+		}
+
+		key := resource.PropertyKey(getOrKey(p.metadata.APIToSDKNameMap, apiName))
+		if value, ok := obj[key]; ok {
+			p.applyValueDefaults(value, propSchemaRef.Value)
+			continue
+		}
+
+		if propSchemaRef.Value.Default == nil || propSchemaRef.Value.ReadOnly {
+			continue
+		}
+
+		logging.V(3).Infof("Setting default value for property %q", key)
+		obj[key] = resource.NewPropertyValue(p.toSDKValue(propSchemaRef.Value.Default))
+	}
+
+	for _, schemaRef := range schema.AllOf {
+		if schemaRef.Value != nil {
+			p.applyObjectDefaults(obj, schemaRef.Value)
+		}
+	}
+
+	if branch := getDiscriminatedSchema(resource.NewObjectProperty(obj), schema, p.metadata.APIToSDKNameMap); branch != nil {
+		p.applyObjectDefaults(obj, branch)
+	}
+}
+
+// toSDKValue returns a copy of a JSON value from the OpenAPI doc with
+// the properties of objects renamed to their SDK names.
+func (p *Provider) toSDKValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(val))
+		for k, propValue := range val {
+			obj[getOrKey(p.metadata.APIToSDKNameMap, k)] = p.toSDKValue(propValue)
+		}
+		return obj
+	case []interface{}:
+		arr := make([]interface{}, 0, len(val))
+		for _, item := range val {
+			arr = append(arr, p.toSDKValue(item))
+		}
+		return arr
+	}
+
+	return v
+}
+
+// inputValidator validates the inputs of a resource against the request
+// schema of the API operation. Unknown values are skipped since they
+// cannot be validated until they are resolved.
+type inputValidator struct {
+	sdkToAPINameMap map[string]string
+	apiToSDKNameMap map[string]string
+	// pathParams are the SDK names of the top-level properties that are
+	// not required since they are path params.
+	pathParams map[string]bool
+
+	failures []*pulumirpc.CheckFailure
+}
+
+// validateInputs returns a CheckFailure for each input that does not
+// conform to the request schema of the resource's create operation.
+func (p *Provider) validateInputs(crudMap *providerGen.CRUDOperationsMap, inputs resource.PropertyMap) []*pulumirpc.CheckFailure {
+	schema := p.getCreateRequestSchema(crudMap)
+	if schema == nil {
+		return nil
+	}
+
+	v := &inputValidator{
+		sdkToAPINameMap: p.metadata.SDKToAPINameMap,
+		apiToSDKNameMap: p.metadata.APIToSDKNameMap,
+		pathParams:      p.getPathParamPropertyNames(crudMap),
+	}
+	v.validateValue(nil, resource.NewObjectProperty(inputs), schema)
+
+	return v.failures
+}
+
+// getPathParamPropertyNames returns the SDK names of the path params of
+// the resource's create operation and of the provider's global path
+// params. Their values can come from elsewhere than the inputs, e.g.
+// the provider config, so they are never required.
+func (p *Provider) getPathParamPropertyNames(crudMap *providerGen.CRUDOperationsMap) map[string]bool {
+	names := make(map[string]bool)
+	for name := range p.config().globalPathParams {
+		names[name] = true
+	}
+
+	if crudMap.C == nil {
+		return names
+	}
+
+	for _, segment := range strings.Split(*crudMap.C, "/") {
+		if !strings.HasPrefix(segment, "{") {
+			continue
+		}
+
+		names[getOrKey(p.metadata.PathParamNameMap, strings.Trim(segment, "{}"))] = true
+	}
+
+	return names
+}
+
+func (v *inputValidator) fail(path resource.PropertyPath, reason string) {
+	v.failures = append(v.failures, &pulumirpc.CheckFailure{
+		Property: path.String(),
+		Reason:   reason,
+	})
+}
+
+func (v *inputValidator) validateValue(path resource.PropertyPath, value resource.PropertyValue, schema *openapi3.Schema) {
+	if schema == nil {
+		return
+	}
+
+	value, known := unwrapPropertyValue(value)
+	if !known || value.IsNull() {
+		return
+	}
+
+	switch {
+	case value.IsObject():
+		if !schema.Type.Permits(openapi3.TypeObject) {
+			v.fail(path, fmt.Sprintf("value must be of type %s", typesString(schema.Type)))
+			return
+		}
+		v.validateComposition(path, value, schema)
+		v.validateObject(path, value.ObjectValue(), schema)
+	case value.IsArray():
+		if !schema.Type.Permits(openapi3.TypeArray) {
+			v.fail(path, fmt.Sprintf("value must be of type %s", typesString(schema.Type)))
+			return
+		}
+		v.validateComposition(path, value, schema)
+		v.validateArray(path, value.ArrayValue(), schema)
+	case value.IsString(), value.IsNumber(), value.IsBool():
+		v.visitJSON(path, value, schema)
+	}
+}
+
+func (v *inputValidator) validateObject(path resource.PropertyPath, obj resource.PropertyMap, schema *openapi3.Schema) {
+	for _, apiName := range schema.Required {
+		if propSchemaRef, ok := schema.Properties[apiName]; ok && propSchemaRef.Value != nil && propSchemaRef.Value.ReadOnly {
+			continue
+		}
+
+		sdkName := getOrKey(v.apiToSDKNameMap, apiName)
+		if len(path) == 0 && v.pathParams[sdkName] {
+			continue
+		}
+
+		if _, ok := obj[resource.PropertyKey(sdkName)]; !ok {
+			v.fail(appendPath(path, sdkName), fmt.Sprintf("missing required property '%s'", sdkName))
+		}
+	}
+
+	for _, key := range obj.StableKeys() {
+		propSchemaRef, ok := schema.Properties[getOrKey(v.sdkToAPINameMap, string(key))]
+		switch {
+		case ok:
+			v.validateValue(appendPath(path, string(key)), obj[key], propSchemaRef.Value)
+		case schema.AdditionalProperties.Schema != nil:
+			v.validateValue(appendPath(path, string(key)), obj[key], schema.AdditionalProperties.Schema.Value)
+		}
+	}
+}
+
+func (v *inputValidator) validateArray(path resource.PropertyPath, arr []resource.PropertyValue, schema *openapi3.Schema) {
+	if uint64(len(arr)) < schema.MinItems {
+		v.fail(path, fmt.Sprintf("minimum number of items is %d", schema.MinItems))
+	}
+	if schema.MaxItems != nil && uint64(len(arr)) > *schema.MaxItems {
+		v.fail(path, fmt.Sprintf("maximum number of items is %d", *schema.MaxItems))
+	}
+
+	if schema.Items == nil {
+		return
+	}
+
+	for i, item := range arr {
+		v.validateValue(appendPath(path, i), item, schema.Items.Value)
+	}
+}
+
+// validateComposition validates an object or an array against the
+// schemas it is composed of.
+func (v *inputValidator) validateComposition(path resource.PropertyPath, value resource.PropertyValue, schema *openapi3.Schema) {
+	for _, schemaRef := range schema.AllOf {
+		v.validateValue(path, value, schemaRef.Value)
+	}
+
+	if len(schema.OneOf) == 0 && len(schema.AnyOf) == 0 {
+		return
+	}
+
+	if schema.Discriminator != nil {
+		// The discriminator property may be set by the provider when
+		// the request is sent, so the value is only validated if the
+		// discriminator selects one of the alternatives.
+		if branch := getDiscriminatedSchema(value, schema, v.apiToSDKNameMap); branch != nil {
+			v.validateValue(path, value, branch)
+		}
+		return
+	}
+
+	// Without a discriminator, the value can only be validated against
+	// the alternatives once all of it is known.
+	if value.ContainsUnknowns() {
+		return
+	}
+
+	apiValue := v.toAPIValue(value)
+	for _, schemaRefs := range []openapi3.SchemaRefs{schema.OneOf, schema.AnyOf} {
+		for _, schemaRef := range schemaRefs {
+			if schemaRef.Value == nil || schemaRef.Value.VisitJSON(apiValue, schemaValidationOptions()...) == nil {
+				return
+			}
+		}
+	}
+
+	v.fail(path, "value doesn't match any of the allowed schemas")
+}
+
+// visitJSON validates a value that is fully known using the schema
+// validation of kin-openapi.
+func (v *inputValidator) visitJSON(path resource.PropertyPath, value resource.PropertyValue, schema *openapi3.Schema) {
+	if err := schema.VisitJSON(v.toAPIValue(value), schemaValidationOptions()...); err != nil {
+		v.addSchemaErrors(path, err)
+	}
+}
+
+func schemaValidationOptions() []openapi3.SchemaValidationOption {
+	return []openapi3.SchemaValidationOption{
+		openapi3.MultiErrors(),
+		openapi3.VisitAsRequest(),
+		openapi3.EnableFormatValidation(),
+		openapi3.WithStringFormatValidators(checkStringFormatValidators),
+	}
+}
+
+func (v *inputValidator) addSchemaErrors(path resource.PropertyPath, err error) {
+	var multiErr openapi3.MultiError
+	if errors.As(err, &multiErr) {
+		for _, e := range multiErr {
+			v.addSchemaErrors(path, e)
+		}
+		return
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if !errors.As(err, &schemaErr) {
+		v.fail(path, err.Error())
+		return
+	}
+
+	errPath := path
+	for _, segment := range schemaErr.JSONPointer() {
+		if i, err := strconv.Atoi(segment); err == nil {
+			errPath = appendPath(errPath, i)
+		} else {
+			errPath = appendPath(errPath, getOrKey(v.apiToSDKNameMap, segment))
+		}
+	}
+
+	v.fail(errPath, schemaErr.Reason)
+}
+
+// toAPIValue returns the JSON representation of a value as it would be
+// sent to the API.
+func (v *inputValidator) toAPIValue(value resource.PropertyValue) interface{} {
+	value, _ = unwrapPropertyValue(value)
+
+	switch {
+	case value.IsObject():
+		obj := make(map[string]interface{})
+		for key, propValue := range value.ObjectValue() {
+			obj[getOrKey(v.sdkToAPINameMap, string(key))] = v.toAPIValue(propValue)
+		}
+		return obj
+	case value.IsArray():
+		arr := make([]interface{}, 0, len(value.ArrayValue()))
+		for _, item := range value.ArrayValue() {
+			arr = append(arr, v.toAPIValue(item))
+		}
+		return arr
+	case value.IsString(), value.IsNumber(), value.IsBool():
+		return value.V
+	}
+
+	return nil
+}
+
+// getDiscriminatedSchema returns the schema of the oneOf or anyOf
+// alternative that the discriminator property of an object selects.
+func getDiscriminatedSchema(value resource.PropertyValue, schema *openapi3.Schema, apiToSDKNameMap map[string]string) *openapi3.Schema {
+	if schema.Discriminator == nil || !value.IsObject() {
+		return nil
+	}
+
+	discriminatorValue, known := unwrapPropertyValue(value.ObjectValue()[resource.PropertyKey(getOrKey(apiToSDKNameMap, schema.Discriminator.PropertyName))])
+	if !known || !discriminatorValue.IsString() {
+		return nil
+	}
+
+	ref := "#/components/schemas/" + discriminatorValue.StringValue()
+	if mappingRef, ok := schema.Discriminator.Mapping[discriminatorValue.StringValue()]; ok {
+		if mappingRef.Value != nil {
+			return mappingRef.Value
+		}
+		ref = mappingRef.Ref
+	}
+
+	for _, schemaRefs := range []openapi3.SchemaRefs{schema.OneOf, schema.AnyOf} {
+		for _, schemaRef := range schemaRefs {
+			if schemaRef.Ref == ref {
+				return schemaRef.Value
+			}
+		}
+	}
+
+	return nil
+}
+
+// unwrapPropertyValue returns the value of a secret or an output, and
+// whether it is known.
+func unwrapPropertyValue(value resource.PropertyValue) (resource.PropertyValue, bool) {
+	for {
+		switch {
+		case value.IsSecret():
+			value = value.SecretValue().Element
+		case value.IsOutput():
+			output := value.OutputValue()
+			if !output.Known {
+				return value, false
+			}
+			value = output.Element
+		case value.IsComputed():
+			return value, false
+		default:
+			return value, true
+		}
+	}
+}
+
+func typesString(types *openapi3.Types) string {
+	if types == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%v", types.Slice())
+}
@@ -0,0 +1,205 @@
+package rest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+
+	"github.com/cloudy-sky-software/pulumi-provider-framework/state"
+)
+
+const validatedResourceTypeToken = "generic:validatedresource/v2:ValidatedResource"
+
+func checkValidatedResource(ctx context.Context, t *testing.T, inputs resource.PropertyMap) *pulumirpc.CheckResponse {
+	t.Helper()
+
+	p := makeTestGenericProvider(ctx, t, nil, nil)
+
+	news, err := plugin.MarshalProperties(inputs, state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	checkResp, err := p.Check(ctx, &pulumirpc.CheckRequest{
+		Urn:  "urn:pulumi:some-stack::some-project::" + validatedResourceTypeToken + "::myResource",
+		News: news,
+	})
+	require.NoError(t, err)
+
+	return checkResp
+}
+
+func TestCheckReturnsFailuresForInvalidInputs(t *testing.T) {
+	ctx := context.Background()
+
+	checkResp := checkValidatedResource(ctx, t, resource.NewPropertyMapFromMap(map[string]any{
+		"region":       "lon",
+		"size":         20,
+		"contactEmail": "not-an-email",
+		"slug":         "Not A Slug",
+		"settings":     map[string]any{},
+		"labels":       []any{"a", "", "c"},
+	}))
+
+	failures := make(map[string]string)
+	for _, failure := range checkResp.GetFailures() {
+		failures[failure.GetProperty()] = failure.GetReason()
+	}
+
+	assert.Len(t, failures, 7)
+	assert.Contains(t, failures["region"], "value is not one of the allowed values")
+	assert.Contains(t, failures["size"], "number must be at most 10")
+	assert.Contains(t, failures["contactEmail"], `doesn't match the format "email"`)
+	assert.Contains(t, failures["slug"], "regular expression")
+	assert.Equal(t, "missing required property 'mode'", failures["settings.mode"])
+	assert.Equal(t, "maximum number of items is 2", failures["labels"])
+	assert.Contains(t, failures["labels[1]"], "minimum string length is 1")
+}
+
+func TestCheckSkipsUnknownInputs(t *testing.T) {
+	ctx := context.Background()
+
+	inputs := resource.NewPropertyMapFromMap(map[string]any{
+		"region": resource.MakeComputed(resource.NewStringProperty("")),
+		"settings": map[string]any{
+			"mode": resource.MakeComputed(resource.NewStringProperty("")),
+		},
+		"labels": resource.MakeComputed(resource.NewArrayProperty(nil)),
+	})
+
+	checkResp := checkValidatedResource(ctx, t, inputs)
+	assert.Empty(t, checkResp.GetFailures())
+}
+
+func TestCheckReportsMissingRequiredInputs(t *testing.T) {
+	ctx := context.Background()
+
+	checkResp := checkValidatedResource(ctx, t, resource.NewPropertyMapFromMap(map[string]any{
+		"size": 2,
+	}))
+
+	var properties []string
+	for _, failure := range checkResp.GetFailures() {
+		properties = append(properties, failure.GetProperty())
+	}
+	assert.ElementsMatch(t, []string{"region", "settings"}, properties)
+}
+
+func TestCheckDoesNotRequirePathParams(t *testing.T) {
+	ctx := context.Background()
+
+	p := makeTestGenericProvider(ctx, t, nil, nil).(*Provider)
+
+	// The region is a path param of the create operation.
+	createPath := "/v2/{region}/validatedresource"
+	p.openAPIDoc.Paths.Set(createPath, p.openAPIDoc.Paths.Find("/v2/validatedresource"))
+	p.metadata.ResourceCRUDMap[validatedResourceTypeToken].C = &createPath
+
+	// The settings are set by a global path param.
+	cfg := *p.config()
+	cfg.globalPathParams = map[string]string{"settings": "fast"}
+	p.cfg.Store(&cfg)
+
+	news, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(map[string]any{
+		"size": 2,
+	}), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	checkResp, err := p.Check(ctx, &pulumirpc.CheckRequest{
+		Urn:  "urn:pulumi:some-stack::some-project::" + validatedResourceTypeToken + "::myResource",
+		News: news,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, checkResp.GetFailures())
+}
+
+func TestCheckAppliesDefaultValues(t *testing.T) {
+	ctx := context.Background()
+
+	checkResp := checkValidatedResource(ctx, t, resource.NewPropertyMapFromMap(map[string]any{
+		"region": "nyc",
+		"settings": map[string]any{
+			"mode": "fast",
+		},
+	}))
+	require.Empty(t, checkResp.GetFailures())
+
+	inputs, err := plugin.UnmarshalProperties(checkResp.GetInputs(), state.DefaultUnmarshalOpts)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, inputs["size"].NumberValue())
+	assert.Equal(t, 3.0, inputs["settings"].ObjectValue()["maxRetries"].NumberValue())
+
+	// Properties that are set are not overwritten by their default values.
+	checkResp = checkValidatedResource(ctx, t, resource.NewPropertyMapFromMap(map[string]any{
+		"region": "nyc",
+		"size":   5,
+		"settings": map[string]any{
+			"mode": "fast",
+		},
+	}))
+
+	inputs, err = plugin.UnmarshalProperties(checkResp.GetInputs(), state.DefaultUnmarshalOpts)
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, inputs["size"].NumberValue())
+}
+
+func TestDiffIgnoresDefaultValuesMissingFromOldInputs(t *testing.T) {
+	ctx := context.Background()
+
+	p := makeTestGenericProvider(ctx, t, nil, nil)
+
+	// The old inputs were stored before Check set the default values.
+	olds := `{"region":"nyc","settings":{"mode":"fast"}}`
+	checkResp := checkValidatedResource(ctx, t, resource.NewPropertyMapFromMap(map[string]any{
+		"region": "nyc",
+		"settings": map[string]any{
+			"mode": "fast",
+		},
+	}))
+
+	diffResp, err := p.Diff(ctx, &pulumirpc.DiffRequest{
+		Id:        "fake-id",
+		OldInputs: getMarshaledProps(t, olds),
+		News:      checkResp.GetInputs(),
+		Urn:       "urn:pulumi:some-stack::some-project::" + validatedResourceTypeToken + "::myResource",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, pulumirpc.DiffResponse_DIFF_NONE, diffResp.GetChanges())
+
+	// A value other than the default is still a change.
+	diffResp, err = p.Diff(ctx, &pulumirpc.DiffRequest{
+		Id:        "fake-id",
+		OldInputs: getMarshaledProps(t, olds),
+		News:      getMarshaledProps(t, `{"region":"nyc","size":5,"settings":{"mode":"fast","maxRetries":3}}`),
+		Urn:       "urn:pulumi:some-stack::some-project::" + validatedResourceTypeToken + "::myResource",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, pulumirpc.DiffResponse_DIFF_SOME, diffResp.GetChanges())
+	assert.Equal(t, []string{"size"}, diffResp.GetDiffs())
+}
+
+func TestCheckAppliesDefaultValuesOfDiscriminatedSchema(t *testing.T) {
+	ctx := context.Background()
+
+	p := makeTestGenericProvider(ctx, t, nil, nil)
+
+	news, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(map[string]any{
+		"type":       "cron_job",
+		"simpleProp": "a value",
+	}), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	checkResp, err := p.Check(ctx, &pulumirpc.CheckRequest{
+		Urn:  "urn:pulumi:some-stack::some-project::generic:discriminatedresource/v2:CronJob::myResource",
+		News: news,
+	})
+	require.NoError(t, err)
+
+	inputs, err := plugin.UnmarshalProperties(checkResp.GetInputs(), state.DefaultUnmarshalOpts)
+	require.NoError(t, err)
+	assert.Equal(t, "@daily", inputs["schedule"].StringValue())
+}
@@ -0,0 +1,240 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/logging"
+)
+
+// ConcurrencyScope determines which mutating operations share a
+// concurrency limit.
+type ConcurrencyScope string
+
+const (
+	// ConcurrencyScopeHost limits the mutating operations sent to the
+	// same API host.
+	ConcurrencyScopeHost ConcurrencyScope = "host"
+	// ConcurrencyScopeParent limits the mutating operations of resources
+	// under the same parent object, e.g. `/tailnet/{tailnet}`.
+	ConcurrencyScopeParent ConcurrencyScope = "parent"
+	// ConcurrencyScopeResourceType limits the mutating operations of
+	// resources of the same type.
+	ConcurrencyScopeResourceType ConcurrencyScope = "resourceType"
+)
+
+// ConcurrencyHint limits the number of mutating operations, i.e. create,
+// update and delete, that are in flight at the same time. An operation
+// holds its slot until it completes, including waiting for async
+// operations and for the resource to be ready.
+type ConcurrencyHint struct {
+	// Scope determines which operations share the limit.
+	Scope ConcurrencyScope `json:"scope"`
+	// ParentPath is the OpenAPI path of the parent object whose resolved
+	// value keys the limit when Scope is ConcurrencyScopeParent, e.g.
+	// `/tailnet/{tailnet}`. If empty, the endpoint path up to its last
+	// path param before the resource's own id is used.
+	ParentPath string `json:"parentPath,omitempty"`
+	// MaxConcurrent is the number of operations that can be in flight at
+	// the same time. Operations are serialized if this is less than 1.
+	MaxConcurrent int `json:"maxConcurrent,omitempty"`
+}
+
+// concurrencyLimiter is a set of semaphores keyed by the scope that the
+// operations holding them are limited by. Operations of the same scope
+// with different limits, e.g. of resource types under the same parent
+// with different hints, share a semaphore whose limit is the lowest of
+// theirs.
+type concurrencyLimiter struct {
+	mu         sync.Mutex
+	semaphores map[string]*semaphore
+}
+
+type semaphore struct {
+	// held is the number of slots that are held.
+	held int
+	// limits counts the operations holding or waiting for a slot by
+	// their limit, so that the semaphore can be removed when it is no
+	// longer used.
+	limits map[int]int
+	// changed is closed when a slot is released or the limit changes.
+	changed chan struct{}
+}
+
+// limit returns the lowest limit of the operations holding or waiting
+// for a slot.
+func (s *semaphore) limit() int {
+	limit := 0
+	for l := range s.limits {
+		if limit == 0 || l < limit {
+			limit = l
+		}
+	}
+
+	return limit
+}
+
+func newConcurrencyLimiter() *concurrencyLimiter {
+	return &concurrencyLimiter{
+		semaphores: make(map[string]*semaphore),
+	}
+}
+
+// acquire waits until a slot for key is available or ctx is done.
+// The returned func must be called to release the slot.
+func (l *concurrencyLimiter) acquire(ctx context.Context, key string, maxConcurrent int) (func(), error) {
+	limit := max(maxConcurrent, 1)
+
+	l.mu.Lock()
+	sem, ok := l.semaphores[key]
+	if !ok {
+		sem = &semaphore{limits: make(map[int]int), changed: make(chan struct{})}
+		l.semaphores[key] = sem
+	}
+	sem.limits[limit]++
+
+	for sem.held >= sem.limit() {
+		changed := sem.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			l.mu.Lock()
+			l.unref(key, sem, limit)
+			l.mu.Unlock()
+			return nil, errors.Wrapf(ctx.Err(), "waiting for concurrent operations under %s to complete", key)
+		}
+
+		l.mu.Lock()
+	}
+	sem.held++
+	l.mu.Unlock()
+
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		sem.held--
+		l.unref(key, sem, limit)
+	}, nil
+}
+
+// unref removes an operation with the given limit from a semaphore and
+// wakes up the operations waiting for it. l.mu must be held.
+func (l *concurrencyLimiter) unref(key string, sem *semaphore, limit int) {
+	sem.limits[limit]--
+	if sem.limits[limit] == 0 {
+		delete(sem.limits, limit)
+	}
+	if len(sem.limits) == 0 {
+		delete(l.semaphores, key)
+	}
+
+	close(sem.changed)
+	sem.changed = make(chan struct{})
+}
+
+// getConcurrencyHint returns the concurrency limit of the mutating
+// operations of a resource type, if any.
+func (p *Provider) getConcurrencyHint(resourceTypeToken string) (ConcurrencyHint, bool) {
+	if hint, ok := p.frameworkMetadata.ConcurrencyMap[resourceTypeToken]; ok {
+		return hint, true
+	}
+
+	if p.concurrencyHint != nil {
+		return *p.concurrencyHint, true
+	}
+
+	return ConcurrencyHint{}, false
+}
+
+// acquireConcurrencySlot waits until the mutating operation httpReq of a
+// resource can be sent without exceeding the concurrency limit of the
+// resource type. The returned func must be called once the operation
+// completes.
+func (p *Provider) acquireConcurrencySlot(ctx context.Context, resourceTypeToken, endpointPath string, httpReq *http.Request) (func(), error) {
+	hint, ok := p.getConcurrencyHint(resourceTypeToken)
+	if !ok {
+		return func() {}, nil
+	}
+
+	key, err := getConcurrencyKey(hint, resourceTypeToken, endpointPath, httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys of different scopes never share a semaphore.
+	key = string(hint.Scope) + ":" + key
+
+	logging.V(3).Infof("Waiting for a concurrency slot for %s %s (key: %s)", httpReq.Method, redactURL(httpReq.URL), key)
+	return p.concurrencyLimiter.acquire(ctx, key, hint.MaxConcurrent)
+}
+
+// getConcurrencyKey returns the key of the semaphore that limits the
+// concurrency of httpReq.
+func getConcurrencyKey(hint ConcurrencyHint, resourceTypeToken, endpointPath string, httpReq *http.Request) (string, error) {
+	switch hint.Scope {
+	case ConcurrencyScopeHost:
+		return httpReq.URL.Host, nil
+	case ConcurrencyScopeResourceType:
+		return resourceTypeToken, nil
+	case ConcurrencyScopeParent:
+		parentPath, err := getParentPath(hint.ParentPath, endpointPath)
+		if err != nil {
+			return "", err
+		}
+
+		// The request path may have a prefix from the base URL so the
+		// segments of the endpoint path are matched from the end.
+		reqSegments := strings.Split(strings.Trim(httpReq.URL.Path, "/"), "/")
+		endpointSegments := strings.Split(strings.Trim(endpointPath, "/"), "/")
+		offset := len(reqSegments) - len(endpointSegments)
+		if offset < 0 {
+			return "", errors.Errorf("request path %s does not match endpoint %s", httpReq.URL.Path, endpointPath)
+		}
+
+		parentSegments := reqSegments[:offset+len(parentPath)]
+		return httpReq.URL.Host + "/" + strings.Join(parentSegments, "/"), nil
+	default:
+		return "", errors.Errorf("unknown concurrency scope %q", hint.Scope)
+	}
+}
+
+// getParentPath returns the segments of the endpoint path that belong
+// to the parent object of a resource.
+func getParentPath(parentPath, endpointPath string) ([]string, error) {
+	endpointSegments := strings.Split(strings.Trim(endpointPath, "/"), "/")
+
+	if parentPath != "" {
+		parentSegments := strings.Split(strings.Trim(parentPath, "/"), "/")
+		if len(parentSegments) > len(endpointSegments) {
+			return nil, errors.Errorf("parent path %s is not a prefix of endpoint %s", parentPath, endpointPath)
+		}
+		for i, segment := range parentSegments {
+			if segment != endpointSegments[i] {
+				return nil, errors.Errorf("parent path %s is not a prefix of endpoint %s", parentPath, endpointPath)
+			}
+		}
+
+		return parentSegments, nil
+	}
+
+	// The last segment is the resource's own id for endpoints of an
+	// existing resource, so the parent is the path up to the last path
+	// param before it.
+	for i := len(endpointSegments) - 2; i >= 0; i-- {
+		if isPathParam(endpointSegments[i]) {
+			return endpointSegments[:i+1], nil
+		}
+	}
+
+	return nil, nil
+}
+
+func isPathParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
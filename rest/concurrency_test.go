@@ -0,0 +1,269 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+
+	"github.com/cloudy-sky-software/pulumi-provider-framework/state"
+)
+
+// TestConcurrentOperations runs resource operations concurrently with
+// each other and with re-configuring the provider. It is meant to be run
+// with the race detector.
+func TestConcurrentOperations(t *testing.T) {
+	ctx := context.Background()
+
+	outputsJSON := `{"id":"fake-id","another_prop":"output value"}`
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_, _ = io.WriteString(w, outputsJSON)
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+
+	const concurrency = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrency*5)
+
+	for i := range concurrency {
+		wg.Go(func() {
+			_, err := createFakeResource(ctx, t, p, 0)
+			errs <- err
+
+			_, err = readFakeResource(ctx, t, p)
+			errs <- err
+
+			errs <- updateFakeResource(ctx, t, p)
+
+			errs <- deleteFakeResource(ctx, t, p)
+		})
+
+		wg.Go(func() {
+			_, err := p.Configure(ctx, &pulumirpc.ConfigureRequest{
+				Variables: map[string]string{
+					"generic:config:retryMaxAttempts": fmt.Sprint(i%3 + 1),
+				},
+				SendsOldInputs:         true,
+				SendsOldInputsToDelete: true,
+			})
+			errs <- err
+		})
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+}
+
+func updateFakeResource(ctx context.Context, t *testing.T, p pulumirpc.ResourceProviderServer) error {
+	t.Helper()
+
+	olds, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(map[string]any{
+		"id":          "fake-id",
+		"anotherProp": "output value",
+		"simpleProp":  "somevalue",
+	}), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	_, err = p.Update(ctx, &pulumirpc.UpdateRequest{
+		Id:        "fake-id",
+		Olds:      olds,
+		News:      getMarshaledProps(t, `{"simpleProp":"new value"}`),
+		OldInputs: getMarshaledProps(t, `{"simpleProp":"somevalue"}`),
+		Type:      fakeResourceTypeToken,
+		Name:      "myResource",
+		Urn:       "urn:pulumi:some-stack::some-project::" + fakeResourceTypeToken + "::myResource",
+	})
+	return err
+}
+
+func TestConcurrencyLimitSerializesMutations(t *testing.T) {
+	ctx := context.Background()
+
+	var inFlight, maxInFlight atomic.Int32
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		_, _ = io.WriteString(w, `{"id":"fake-id","another_prop":"output value"}`)
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	p.(*Provider).frameworkMetadata.ConcurrencyMap = map[string]ConcurrencyHint{
+		fakeResourceTypeToken: {Scope: ConcurrencyScopeParent},
+	}
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Go(func() {
+			_, err := createFakeResource(ctx, t, p, 0)
+			assert.NoError(t, err)
+		})
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), maxInFlight.Load())
+}
+
+func TestConcurrencyLimitRespectsContextCancellation(t *testing.T) {
+	ctx := context.Background()
+
+	requested := make(chan struct{})
+	unblock := make(chan struct{})
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		close(requested)
+		<-unblock
+		_, _ = io.WriteString(w, `{"id":"fake-id","another_prop":"output value"}`)
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+	defer close(unblock)
+
+	p := makeTestGenericProviderWithOpts(ctx, t, testServer, nil, true, WithConcurrencyLimit(ConcurrencyHint{
+		Scope:         ConcurrencyScopeHost,
+		MaxConcurrent: 1,
+	}))
+
+	go func() {
+		_, _ = createFakeResource(ctx, t, p, 0)
+	}()
+	<-requested
+
+	// The second operation is queued until its timeout elapses.
+	_, err := createFakeResource(ctx, t, p, 0.1)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestConcurrencyLimitsOfSameScopeUseLowestLimit(t *testing.T) {
+	ctx := context.Background()
+
+	l := newConcurrencyLimiter()
+
+	releaseFirst, err := l.acquire(ctx, "parent:api.example.com/tailnet/example.com", 2)
+	require.NoError(t, err)
+
+	// An operation with a lower limit under the same parent is held to
+	// it by the operations with a higher limit...
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = l.acquire(timeoutCtx, "parent:api.example.com/tailnet/example.com", 1)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// ...and they are held to it while it waits.
+	acquired := make(chan func())
+	go func() {
+		release, err := l.acquire(ctx, "parent:api.example.com/tailnet/example.com", 1)
+		assert.NoError(t, err)
+		acquired <- release
+	}()
+	require.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.semaphores["parent:api.example.com/tailnet/example.com"].limit() == 1
+	}, time.Second, time.Millisecond)
+
+	timeoutCtx, cancel = context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = l.acquire(timeoutCtx, "parent:api.example.com/tailnet/example.com", 2)
+	require.Error(t, err)
+
+	releaseFirst()
+	release := <-acquired
+	release()
+
+	assert.Empty(t, l.semaphores)
+}
+
+func TestGetConcurrencyKey(t *testing.T) {
+	tests := []struct {
+		name         string
+		hint         ConcurrencyHint
+		endpointPath string
+		reqURL       string
+		expectedKey  string
+	}{
+		{
+			name:         "host",
+			hint:         ConcurrencyHint{Scope: ConcurrencyScopeHost},
+			endpointPath: "/tailnet/{tailnet}/keys",
+			reqURL:       "https://api.example.com/api/v2/tailnet/example.com/keys",
+			expectedKey:  "api.example.com",
+		},
+		{
+			name:         "resource type",
+			hint:         ConcurrencyHint{Scope: ConcurrencyScopeResourceType},
+			endpointPath: "/tailnet/{tailnet}/keys",
+			reqURL:       "https://api.example.com/api/v2/tailnet/example.com/keys",
+			expectedKey:  fakeResourceTypeToken,
+		},
+		{
+			name:         "parent of a create endpoint",
+			hint:         ConcurrencyHint{Scope: ConcurrencyScopeParent},
+			endpointPath: "/tailnet/{tailnet}/keys",
+			reqURL:       "https://api.example.com/api/v2/tailnet/example.com/keys",
+			expectedKey:  "api.example.com/api/v2/tailnet/example.com",
+		},
+		{
+			name:         "parent of an update endpoint",
+			hint:         ConcurrencyHint{Scope: ConcurrencyScopeParent},
+			endpointPath: "/tailnet/{tailnet}/keys/{keyId}",
+			reqURL:       "https://api.example.com/api/v2/tailnet/example.com/keys/key-1",
+			expectedKey:  "api.example.com/api/v2/tailnet/example.com",
+		},
+		{
+			name:         "explicit parent path",
+			hint:         ConcurrencyHint{Scope: ConcurrencyScopeParent, ParentPath: "/tailnet/{tailnet}"},
+			endpointPath: "/tailnet/{tailnet}/devices/{deviceId}/routes",
+			reqURL:       "https://api.example.com/api/v2/tailnet/example.com/devices/device-1/routes",
+			expectedKey:  "api.example.com/api/v2/tailnet/example.com",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			httpReq, err := http.NewRequest(http.MethodPost, test.reqURL, nil)
+			require.NoError(t, err)
+
+			key, err := getConcurrencyKey(test.hint, fakeResourceTypeToken, test.endpointPath, httpReq)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedKey, key)
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package rest
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+)
+
+// propertyDiffs collects the detailed diff of a resource's inputs along
+// with the top-level properties that changed or require a replacement.
+type propertyDiffs struct {
+	apiNameLookupMap map[string]string
+
+	detailedDiff map[string]*pulumirpc.PropertyDiff
+	diffs        map[string]struct{}
+	replaces     map[string]struct{}
+}
+
+func newPropertyDiffs(apiNameLookupMap map[string]string) *propertyDiffs {
+	return &propertyDiffs{
+		apiNameLookupMap: apiNameLookupMap,
+		detailedDiff:     make(map[string]*pulumirpc.PropertyDiff),
+		diffs:            make(map[string]struct{}),
+		replaces:         make(map[string]struct{}),
+	}
+}
+
+// determineDiffsAndReplacements returns the top-level properties that
+// require a replacement, the top-level properties that changed and the
+// detailed diff keyed by the full path of each changed property, e.g.
+// `serviceDetails.buildCommand` or `tags[2]`.
+//
+// A property that is not part of the update operation's request schema,
+// at any level of nesting, can only be changed by replacing the resource.
+// If schema is nil, every change requires a replacement.
+func (p *Provider) determineDiffsAndReplacements(d *resource.ObjectDiff, schema *openapi3.Schema) ([]string, []string, map[string]*pulumirpc.PropertyDiff) {
+	pd := newPropertyDiffs(p.metadata.SDKToAPINameMap)
+	pd.addObjectDiff(nil, d, schema, schema == nil)
+
+	return slices.Sorted(maps.Keys(pd.replaces)), slices.Sorted(maps.Keys(pd.diffs)), pd.detailedDiff
+}
+
+func (pd *propertyDiffs) add(path resource.PropertyPath, kind pulumirpc.PropertyDiff_Kind, replace bool) {
+	topLevelProp := path[0].(string)
+	pd.diffs[topLevelProp] = struct{}{}
+
+	if replace {
+		pd.replaces[topLevelProp] = struct{}{}
+		switch kind {
+		case pulumirpc.PropertyDiff_ADD:
+			kind = pulumirpc.PropertyDiff_ADD_REPLACE
+		case pulumirpc.PropertyDiff_DELETE:
+			kind = pulumirpc.PropertyDiff_DELETE_REPLACE
+		case pulumirpc.PropertyDiff_UPDATE:
+			kind = pulumirpc.PropertyDiff_UPDATE_REPLACE
+		}
+	}
+
+	pd.detailedDiff[path.String()] = &pulumirpc.PropertyDiff{
+		Kind:      kind,
+		InputDiff: true,
+	}
+}
+
+// addObjectDiff adds the changes of an object whose schema is schema.
+// If replace is true, all changes to the object require a replacement.
+func (pd *propertyDiffs) addObjectDiff(path resource.PropertyPath, d *resource.ObjectDiff, schema *openapi3.Schema, replace bool) {
+	for key := range d.Adds {
+		_, updatable := pd.lookupProperty(schema, string(key))
+		pd.add(appendPath(path, string(key)), pulumirpc.PropertyDiff_ADD, replace || !updatable)
+	}
+
+	for key := range d.Deletes {
+		_, updatable := pd.lookupProperty(schema, string(key))
+		pd.add(appendPath(path, string(key)), pulumirpc.PropertyDiff_DELETE, replace || !updatable)
+	}
+
+	for key, valueDiff := range d.Updates {
+		propSchema, updatable := pd.lookupProperty(schema, string(key))
+		pd.addValueDiff(appendPath(path, string(key)), valueDiff, propSchema, replace || !updatable)
+	}
+}
+
+func (pd *propertyDiffs) addArrayDiff(path resource.PropertyPath, d *resource.ArrayDiff, itemSchema *openapi3.Schema, replace bool) {
+	for i := range d.Adds {
+		pd.add(appendPath(path, i), pulumirpc.PropertyDiff_ADD, replace)
+	}
+
+	for i := range d.Deletes {
+		pd.add(appendPath(path, i), pulumirpc.PropertyDiff_DELETE, replace)
+	}
+
+	for i, valueDiff := range d.Updates {
+		pd.addValueDiff(appendPath(path, i), valueDiff, itemSchema, replace)
+	}
+}
+
+func (pd *propertyDiffs) addValueDiff(path resource.PropertyPath, d resource.ValueDiff, schema *openapi3.Schema, replace bool) {
+	switch {
+	case d.Object != nil:
+		pd.addObjectDiff(path, d.Object, schema, replace)
+	case d.Array != nil:
+		var itemSchema *openapi3.Schema
+		if schema != nil && schema.Items != nil {
+			itemSchema = schema.Items.Value
+		}
+		pd.addArrayDiff(path, d.Array, itemSchema, replace)
+	default:
+		pd.add(path, pulumirpc.PropertyDiff_UPDATE, replace)
+	}
+}
+
+// lookupProperty returns the schema of the property sdkName of an
+// object, and whether the property can be updated in-place. Objects
+// without declared properties are free-form so any of their
+// properties can be updated.
+func (pd *propertyDiffs) lookupProperty(schema *openapi3.Schema, sdkName string) (*openapi3.Schema, bool) {
+	if schema == nil {
+		return nil, true
+	}
+
+	properties := getSchemaProperties(schema)
+	if len(properties) == 0 {
+		if schema.AdditionalProperties.Schema != nil {
+			return schema.AdditionalProperties.Schema.Value, true
+		}
+		return nil, true
+	}
+
+	propSchemaRef, ok := properties[getOrKey(pd.apiNameLookupMap, sdkName)]
+	if !ok {
+		return nil, false
+	}
+
+	return propSchemaRef.Value, true
+}
+
+// getSchemaProperties returns the properties of an object schema,
+// including those of the schemas it is composed of.
+func getSchemaProperties(schema *openapi3.Schema) openapi3.Schemas {
+	if len(schema.AllOf) == 0 && len(schema.OneOf) == 0 && len(schema.AnyOf) == 0 {
+		return schema.Properties
+	}
+
+	properties := maps.Clone(schema.Properties)
+	if properties == nil {
+		properties = make(openapi3.Schemas)
+	}
+
+	for _, schemaRefs := range []openapi3.SchemaRefs{schema.AllOf, schema.OneOf, schema.AnyOf} {
+		for _, schemaRef := range schemaRefs {
+			if schemaRef.Value == nil {
+				continue
+			}
+			maps.Copy(properties, getSchemaProperties(schemaRef.Value))
+		}
+	}
+
+	return properties
+}
+
+func appendPath(path resource.PropertyPath, key any) resource.PropertyPath {
+	return append(slices.Clone(path), key)
+}
@@ -0,0 +1,245 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/logging"
+)
+
+const problemJSONMimeType = "application/problem+json"
+
+// maxErrorMessageLength is the maximum length of a raw response body
+// that is included in the message of an APIError.
+const maxErrorMessageLength = 1024
+
+// errorMessageProperties are the properties of an error response body
+// that commonly hold the error message, in order of preference.
+var errorMessageProperties = []string{"message", "detail", "error_description", "errorMessage", "error", "title", "msg", "description"}
+
+// ProblemDetails represents an RFC 7807 `application/problem+json`
+// error response.
+type ProblemDetails struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// APIError is returned when the API responds to a request with a status
+// code that was not expected for the operation. Use `errors.As` to
+// inspect it.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Status is the HTTP status of the response, e.g. `404 Not Found`.
+	Status string
+	// Header is the header of the response.
+	Header http.Header
+	// Body is the raw response body.
+	Body []byte
+
+	// Method is the HTTP method of the request.
+	Method string
+	// URL is the URL of the request, with the values of its query params
+	// redacted since they can hold credentials.
+	URL string
+
+	// Problem is the response body parsed as RFC 7807 problem details.
+	// It is nil if the response is not `application/problem+json`.
+	Problem *ProblemDetails
+	// Details is the response body parsed as a JSON object. It is nil
+	// if the response body is not a JSON object.
+	Details map[string]interface{}
+
+	// messageProperty is the property of the operation's declared error
+	// schema that holds the error message.
+	messageProperty string
+}
+
+// Error returns the error message.
+func (e *APIError) Error() string {
+	msg := e.Message()
+	if msg == "" {
+		return fmt.Sprintf("http request failed (status: %s)", e.Status)
+	}
+
+	return fmt.Sprintf("http request failed (status: %s): %s", e.Status, msg)
+}
+
+// Message returns the error message from the API's response. The raw
+// response body is returned if a message cannot be found in it.
+func (e *APIError) Message() string {
+	if e.Problem != nil {
+		switch {
+		case e.Problem.Detail != "" && e.Problem.Title != "":
+			return fmt.Sprintf("%s: %s", e.Problem.Title, e.Problem.Detail)
+		case e.Problem.Detail != "":
+			return e.Problem.Detail
+		case e.Problem.Title != "":
+			return e.Problem.Title
+		}
+	}
+
+	if e.Details != nil {
+		if e.messageProperty != "" {
+			if msg, ok := getErrorMessage(e.Details[e.messageProperty]); ok {
+				return msg
+			}
+		}
+
+		for _, propName := range errorMessageProperties {
+			if msg, ok := getErrorMessage(e.Details[propName]); ok {
+				return msg
+			}
+		}
+
+		// Some APIs return a list of errors.
+		if errs, ok := e.Details["errors"].([]interface{}); ok && len(errs) > 0 {
+			if msg, ok := getErrorMessage(errs[0]); ok {
+				return msg
+			}
+		}
+	}
+
+	msg := strings.TrimSpace(string(e.Body))
+	if len(msg) > maxErrorMessageLength {
+		msg = msg[:maxErrorMessageLength] + "..."
+	}
+
+	return msg
+}
+
+// getErrorMessage returns the error message from a value in an error
+// response body. The value can be the message itself or an object that
+// contains the message.
+func getErrorMessage(v interface{}) (string, bool) {
+	switch val := v.(type) {
+	case string:
+		return val, val != ""
+	case map[string]interface{}:
+		for _, propName := range errorMessageProperties {
+			if msg, ok := val[propName].(string); ok && msg != "" {
+				return msg, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// newAPIError returns an APIError for a response whose body was already
+// read. The operation's declared response schema for the status code is
+// used to find the property that holds the error message.
+func (p *Provider) newAPIError(httpReq *http.Request, httpResp *http.Response, body []byte) *APIError {
+	apiErr := newAPIErrorFromResponse(httpReq, httpResp, body)
+	if httpReq != nil && apiErr.Details != nil {
+		apiErr.messageProperty = p.getErrorMessageProperty(httpReq, httpResp.StatusCode)
+	}
+
+	return apiErr
+}
+
+// newAPIErrorFromResponse returns an APIError for a response whose body
+// was already read without consulting the OpenAPI doc.
+func newAPIErrorFromResponse(httpReq *http.Request, httpResp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: httpResp.StatusCode,
+		Status:     httpResp.Status,
+		Header:     httpResp.Header,
+		Body:       body,
+	}
+
+	if httpReq != nil {
+		apiErr.Method = httpReq.Method
+		apiErr.URL = redactURL(httpReq.URL)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(httpResp.Header.Get("Content-Type"))
+	if mediaType == problemJSONMimeType {
+		var problem ProblemDetails
+		if err := json.Unmarshal(body, &problem); err == nil {
+			apiErr.Problem = &problem
+		} else {
+			logging.V(3).Infof("Failed to parse problem details from the response: %v", err)
+		}
+	}
+
+	var details map[string]interface{}
+	if err := json.Unmarshal(body, &details); err == nil {
+		apiErr.Details = details
+	}
+
+	return apiErr
+}
+
+// getErrorMessageProperty returns the property of the error schema that
+// the operation declares for a status code that holds the error message.
+func (p *Provider) getErrorMessageProperty(httpReq *http.Request, statusCode int) string {
+	router := p.config().router
+	if router == nil {
+		return ""
+	}
+
+	route, _, err := router.FindRoute(httpReq)
+	if err != nil || route.Operation == nil || route.Operation.Responses == nil {
+		return ""
+	}
+
+	responseRef := route.Operation.Responses.Status(statusCode)
+	if responseRef == nil {
+		responseRef = route.Operation.Responses.Default()
+	}
+	if responseRef == nil || responseRef.Value == nil {
+		return ""
+	}
+
+	for _, mimeType := range []string{problemJSONMimeType, jsonMimeType} {
+		mediaType := responseRef.Value.Content.Get(mimeType)
+		if mediaType == nil || mediaType.Schema == nil || mediaType.Schema.Value == nil {
+			continue
+		}
+
+		if propName := findErrorMessageProperty(mediaType.Schema.Value); propName != "" {
+			return propName
+		}
+	}
+
+	return ""
+}
+
+func findErrorMessageProperty(schema *openapi3.Schema) string {
+	for _, propName := range errorMessageProperties {
+		if _, ok := schema.Properties[propName]; ok {
+			return propName
+		}
+	}
+
+	// Fallback to a property that looks like it holds a message,
+	// e.g. `error_message`.
+	propNames := slices.Sorted(maps.Keys(schema.Properties))
+	for _, propName := range propNames {
+		if strings.Contains(strings.ToLower(propName), "message") {
+			return propName
+		}
+	}
+
+	for _, schemaRef := range schema.AllOf {
+		if schemaRef.Value == nil {
+			continue
+		}
+		if propName := findErrorMessageProperty(schemaRef.Value); propName != "" {
+			return propName
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,112 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+)
+
+func TestAPIErrorMessage(t *testing.T) {
+	tests := []struct {
+		name            string
+		contentType     string
+		body            string
+		messageProperty string
+		expected        string
+	}{
+		{
+			name:        "ProblemDetails",
+			contentType: problemJSONMimeType,
+			body:        `{"type":"https://example.com/probs/out-of-credit","title":"You do not have enough credit.","detail":"Your current balance is 30, but that costs 50.","status":403}`,
+			expected:    "You do not have enough credit.: Your current balance is 30, but that costs 50.",
+		},
+		{
+			name:        "MessageProperty",
+			contentType: jsonMimeType,
+			body:        `{"code":"invalid","message":"name is required"}`,
+			expected:    "name is required",
+		},
+		{
+			name:        "NestedErrorObject",
+			contentType: jsonMimeType,
+			body:        `{"error":{"code":400,"message":"invalid region"}}`,
+			expected:    "invalid region",
+		},
+		{
+			name:        "ErrorsList",
+			contentType: jsonMimeType,
+			body:        `{"errors":[{"message":"first error"},{"message":"second error"}]}`,
+			expected:    "first error",
+		},
+		{
+			name:            "DeclaredMessageProperty",
+			contentType:     jsonMimeType,
+			body:            `{"reason":"Not allowed","explanation":"The key has expired."}`,
+			messageProperty: "explanation",
+			expected:        "The key has expired.",
+		},
+		{
+			name:        "RawBody",
+			contentType: "text/plain",
+			body:        "upstream connect error",
+			expected:    "upstream connect error",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			httpResp := &http.Response{
+				StatusCode: http.StatusBadRequest,
+				Status:     "400 Bad Request",
+				Header:     http.Header{"Content-Type": []string{test.contentType}},
+			}
+
+			apiErr := newAPIErrorFromResponse(nil, httpResp, []byte(test.body))
+			apiErr.messageProperty = test.messageProperty
+			assert.Equal(t, test.expected, apiErr.Message())
+			assert.Equal(t, "http request failed (status: 400 Bad Request): "+test.expected, apiErr.Error())
+		})
+	}
+}
+
+func TestCreateReturnsAPIError(t *testing.T) {
+	ctx := context.Background()
+
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", problemJSONMimeType)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = io.WriteString(w, `{"title":"Invalid input","detail":"simple_prop is too short","status":422}`)
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+
+	_, err := createFakeResource(ctx, t, p, 0)
+	require.Error(t, err)
+
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr), "Expected the error to be an APIError")
+	assert.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+	assert.Equal(t, http.MethodPost, apiErr.Method)
+	assert.Equal(t, testServer.URL+"/v2/fakeresource", apiErr.URL)
+	require.NotNil(t, apiErr.Problem)
+	assert.Equal(t, "simple_prop is too short", apiErr.Problem.Detail)
+	assert.NotContains(t, err.Error(), `"status":422`, "Expected the message to be extracted from the response body")
+
+	_, err = p.Read(ctx, &pulumirpc.ReadRequest{
+		Id:  "/fake-id",
+		Urn: "urn:pulumi:some-stack::some-project::" + fakeResourceTypeToken + "::myResource",
+	})
+	require.True(t, errors.As(err, &apiErr), "Expected the error to be an APIError")
+	assert.Equal(t, http.MethodGet, apiErr.Method)
+}
@@ -0,0 +1,127 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/logging"
+
+	"github.com/cloudy-sky-software/pulumi-provider-framework/state"
+)
+
+const (
+	headerETag    = "ETag"
+	headerIfMatch = "If-Match"
+)
+
+// OptimisticConcurrencyHint opts a resource type in to optimistic
+// concurrency control. The version of the resource is captured when it
+// is created or read, and its updates and deletes are sent with an
+// If-Match header so that they fail instead of overwriting changes made
+// outside of Pulumi.
+type OptimisticConcurrencyHint struct {
+	// VersionProperty is the property of the resource that holds its
+	// version, e.g. `etag` or `version`. If empty, the ETag response
+	// header is stored in the state instead.
+	VersionProperty string `json:"versionProperty,omitempty"`
+}
+
+func (p *Provider) getOptimisticConcurrencyHint(resourceTypeToken string) (OptimisticConcurrencyHint, bool) {
+	hint, ok := p.frameworkMetadata.OptimisticConcurrencyMap[resourceTypeToken]
+	return hint, ok
+}
+
+// storeResourceVersion stores the ETag of httpResp in the state of a
+// resource that opted in to optimistic concurrency control. Nothing is
+// stored if the resource has a version property since it is part of
+// the outputs already.
+func (p *Provider) storeResourceVersion(resourceTypeToken string, httpResp *http.Response, outputState resource.PropertyMap) {
+	hint, ok := p.getOptimisticConcurrencyHint(resourceTypeToken)
+	if !ok || hint.VersionProperty != "" {
+		return
+	}
+
+	if etag := httpResp.Header.Get(headerETag); etag != "" {
+		state.SetETag(outputState, etag)
+	}
+}
+
+// setIfMatchHeader sets the If-Match header of a request that mutates a
+// resource that opted in to optimistic concurrency control to the version
+// of the resource in its state.
+func (p *Provider) setIfMatchHeader(resourceTypeToken string, httpReq *http.Request, currentState resource.PropertyMap) {
+	hint, ok := p.getOptimisticConcurrencyHint(resourceTypeToken)
+	if !ok {
+		return
+	}
+
+	version := state.GetETag(currentState)
+	if hint.VersionProperty != "" {
+		version = getVersionPropertyValue(currentState[resource.PropertyKey(p.getVersionPropertySDKName(hint))])
+	}
+
+	if version == "" {
+		logging.V(3).Infof("The state of %s has no version, sending %s %s without an %s header", resourceTypeToken, httpReq.Method, redactURL(httpReq.URL), headerIfMatch)
+		return
+	}
+
+	httpReq.Header.Set(headerIfMatch, version)
+}
+
+func (p *Provider) getVersionPropertySDKName(hint OptimisticConcurrencyHint) string {
+	return getOrKey(p.metadata.APIToSDKNameMap, hint.VersionProperty)
+}
+
+// excludeVersionProperty removes the version property of a resource from
+// its inputs so that a new version of the resource is not a diff.
+func (p *Provider) excludeVersionProperty(resourceTypeToken string, props ...resource.PropertyMap) {
+	hint, ok := p.getOptimisticConcurrencyHint(resourceTypeToken)
+	if !ok || hint.VersionProperty == "" {
+		return
+	}
+
+	key := resource.PropertyKey(p.getVersionPropertySDKName(hint))
+	for _, m := range props {
+		delete(m, key)
+	}
+}
+
+// getVersionPropertyValue returns a version property as an entity tag.
+func getVersionPropertyValue(v resource.PropertyValue) string {
+	v, known := unwrapPropertyValue(v)
+	if !known {
+		return ""
+	}
+
+	var version string
+	switch {
+	case v.IsString():
+		version = v.StringValue()
+	case v.IsNumber():
+		version = strconv.FormatFloat(v.NumberValue(), 'f', -1, 64)
+	default:
+		return ""
+	}
+
+	if version == "" || strings.HasPrefix(version, `"`) || strings.HasPrefix(version, "W/") {
+		return version
+	}
+
+	return strconv.Quote(version)
+}
+
+// newMutationAPIError returns the error for a failed update or delete
+// request of a resource. A failed If-Match precondition means that the
+// resource was changed outside of Pulumi.
+func (p *Provider) newMutationAPIError(resourceTypeToken string, httpReq *http.Request, httpResp *http.Response, body []byte) error {
+	apiErr := p.newAPIError(httpReq, httpResp, body)
+	if _, ok := p.getOptimisticConcurrencyHint(resourceTypeToken); !ok || httpResp.StatusCode != http.StatusPreconditionFailed {
+		return apiErr
+	}
+
+	return errors.Wrap(apiErr, "resource changed since last refresh, run `pulumi refresh` to get its current state and try again")
+}
@@ -0,0 +1,117 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+
+	"github.com/cloudy-sky-software/pulumi-provider-framework/state"
+)
+
+func TestETagIsSentWithUpdate(t *testing.T) {
+	ctx := context.Background()
+
+	var ifMatch atomic.Value
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			w.Header().Set(headerETag, `"v1"`)
+			_, _ = io.WriteString(w, `{"id":"fake-id","another_prop":"output value"}`)
+		case http.MethodPatch:
+			ifMatch.Store(r.Header.Get(headerIfMatch))
+			w.WriteHeader(http.StatusPreconditionFailed)
+			_, _ = io.WriteString(w, `{"message":"etag mismatch"}`)
+		}
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	p.(*Provider).frameworkMetadata.OptimisticConcurrencyMap = map[string]OptimisticConcurrencyHint{
+		fakeResourceTypeToken: {},
+	}
+
+	createResp, err := createFakeResource(ctx, t, p, 0)
+	require.NoError(t, err)
+
+	outputs, err := plugin.UnmarshalProperties(createResp.GetProperties(), state.DefaultUnmarshalOpts)
+	require.NoError(t, err)
+	assert.Equal(t, `"v1"`, state.GetETag(outputs))
+
+	_, err = p.Update(ctx, &pulumirpc.UpdateRequest{
+		Id:        "fake-id",
+		Olds:      createResp.GetProperties(),
+		News:      getMarshaledProps(t, `{"simpleProp":"new value"}`),
+		OldInputs: getMarshaledProps(t, `{"simpleProp":"somevalue"}`),
+		Type:      fakeResourceTypeToken,
+		Name:      "myResource",
+		Urn:       "urn:pulumi:some-stack::some-project::" + fakeResourceTypeToken + "::myResource",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "resource changed since last refresh")
+	assert.Equal(t, `"v1"`, ifMatch.Load())
+}
+
+func TestVersionPropertyIsSentWithDelete(t *testing.T) {
+	ctx := context.Background()
+
+	var ifMatch atomic.Value
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifMatch.Store(r.Header.Get(headerIfMatch))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	p.(*Provider).frameworkMetadata.OptimisticConcurrencyMap = map[string]OptimisticConcurrencyHint{
+		fakeResourceTypeToken: {VersionProperty: "version"},
+	}
+
+	props, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(map[string]any{
+		"id":      "fake-id",
+		"version": 3,
+	}), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	_, err = p.Delete(ctx, &pulumirpc.DeleteRequest{
+		Id:         "fake-id",
+		Properties: props,
+		Urn:        "urn:pulumi:some-stack::some-project::" + fakeResourceTypeToken + "::myResource",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `"3"`, ifMatch.Load())
+}
+
+func TestVersionPropertyIsExcludedFromDiff(t *testing.T) {
+	ctx := context.Background()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	p.(*Provider).frameworkMetadata.OptimisticConcurrencyMap = map[string]OptimisticConcurrencyHint{
+		fakeResourceTypeToken: {VersionProperty: "version"},
+	}
+
+	diffResp, err := p.Diff(ctx, &pulumirpc.DiffRequest{
+		Id:        "fake-id",
+		OldInputs: getMarshaledProps(t, `{"simpleProp":"somevalue","version":1}`),
+		News:      getMarshaledProps(t, `{"simpleProp":"somevalue","version":2}`),
+		Urn:       "urn:pulumi:some-stack::some-project::" + fakeResourceTypeToken + "::myResource",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, pulumirpc.DiffResponse_DIFF_NONE, diffResp.GetChanges())
+}
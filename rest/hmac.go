@@ -0,0 +1,285 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/pkg/errors"
+)
+
+const (
+	headerSignature = "X-Signature"
+	headerTimestamp = "X-Timestamp"
+
+	// DefaultHMACTemplate is the canonical form of the requests signed by
+	// an HMACAuthenticator that has no template.
+	DefaultHMACTemplate = "{{.Method}}\n{{.Path}}\n{{.Query}}\n{{.BodyHash}}\n{{.Timestamp}}"
+)
+
+// HMACAuthenticator signs requests with an HMAC of their canonical form,
+// which is rendered from a template over the method, path, query, a hash
+// of the body and a timestamp of the request. Requests are signed once they
+// are fully built and again right before every attempt to send them, so
+// that retries are sent with a fresh timestamp.
+type HMACAuthenticator struct {
+	// Secret returns the key of the HMAC.
+	Secret CredentialFunc
+	// KeyID returns the ID of the key, which is sent in KeyIDHeader if
+	// both are set.
+	KeyID       CredentialFunc
+	KeyIDHeader string
+
+	// Template is a text/template of the canonical form of a request,
+	// rendered with an HMACCanonicalRequest. Defaults to
+	// DefaultHMACTemplate.
+	Template string
+	// Hash returns the hash of the HMAC, which is also used to hash the
+	// body. Defaults to sha256.New.
+	Hash func() hash.Hash
+	// EncodeSignature encodes the HMAC. Defaults to hex.EncodeToString.
+	EncodeSignature func([]byte) string
+
+	// SignatureHeader is the header in which the signature is sent.
+	// Defaults to `X-Signature`.
+	SignatureHeader string
+	// SignaturePrefix is prepended to the signature, e.g. `HMAC-SHA256 `.
+	SignaturePrefix string
+	// TimestampHeader is the header in which the timestamp is sent.
+	// Defaults to `X-Timestamp`.
+	TimestampHeader string
+	// TimestampFormat is the layout of the timestamp as accepted by
+	// time.Format. The timestamp is the number of seconds since the Unix
+	// epoch if empty.
+	TimestampFormat string
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	parseOnce   sync.Once
+	template    *template.Template
+	templateErr error
+}
+
+// HMACCanonicalRequest is the data with which the canonical form of a
+// request is rendered.
+type HMACCanonicalRequest struct {
+	Method string
+	Host   string
+	// Path is the escaped path of the request.
+	Path string
+	// Query is the encoded query of the request, sorted by key.
+	Query string
+	// BodyHash is the hex-encoded hash of the body, which is the hash of
+	// an empty body if the request has none.
+	BodyHash  string
+	Timestamp string
+
+	header http.Header
+}
+
+// Header returns the value of a header of the request, so that headers can
+// be part of the canonical form.
+func (r HMACCanonicalRequest) Header(name string) string {
+	return r.header.Get(name)
+}
+
+// Authenticate implements Authenticator.
+func (a *HMACAuthenticator) Authenticate(_ context.Context, httpReq *http.Request, _ openapi3.SecurityRequirements) error {
+	return a.sign(httpReq)
+}
+
+func (a *HMACAuthenticator) getSignatureHeader() string {
+	if a.SignatureHeader == "" {
+		return headerSignature
+	}
+
+	return a.SignatureHeader
+}
+
+func (a *HMACAuthenticator) getTimestampHeader() string {
+	if a.TimestampHeader == "" {
+		return headerTimestamp
+	}
+
+	return a.TimestampHeader
+}
+
+func (a *HMACAuthenticator) getHash() func() hash.Hash {
+	if a.Hash == nil {
+		return sha256.New
+	}
+
+	return a.Hash
+}
+
+func (a *HMACAuthenticator) getTimestamp() string {
+	now := time.Now
+	if a.Now != nil {
+		now = a.Now
+	}
+
+	if a.TimestampFormat == "" {
+		return strconv.FormatInt(now().Unix(), 10)
+	}
+
+	return now().UTC().Format(a.TimestampFormat)
+}
+
+func (a *HMACAuthenticator) getTemplate() (*template.Template, error) {
+	a.parseOnce.Do(func() {
+		text := a.Template
+		if text == "" {
+			text = DefaultHMACTemplate
+		}
+
+		a.template, a.templateErr = template.New("hmac").Option("missingkey=error").Parse(text)
+		a.templateErr = errors.Wrap(a.templateErr, "parsing hmac template")
+	})
+
+	return a.template, a.templateErr
+}
+
+// isSigned returns true if httpReq was signed by the authenticator.
+func (a *HMACAuthenticator) isSigned(httpReq *http.Request) bool {
+	return httpReq.Header.Get(a.getSignatureHeader()) != ""
+}
+
+// sign sets the timestamp and signature headers of httpReq, replacing the
+// previous ones.
+func (a *HMACAuthenticator) sign(httpReq *http.Request) error {
+	tmpl, err := a.getTemplate()
+	if err != nil {
+		return err
+	}
+
+	secret := a.Secret()
+	if secret == "" {
+		return errors.New("hmac secret is not set")
+	}
+
+	if a.KeyID != nil && a.KeyIDHeader != "" {
+		httpReq.Header.Set(a.KeyIDHeader, a.KeyID())
+	}
+
+	body, err := readRequestBody(httpReq)
+	if err != nil {
+		return errors.Wrap(err, "reading request body")
+	}
+
+	newHash := a.getHash()
+	bodyHash := newHash()
+	bodyHash.Write(body)
+
+	timestamp := a.getTimestamp()
+	httpReq.Header.Set(a.getTimestampHeader(), timestamp)
+
+	var canonical strings.Builder
+	if err := tmpl.Execute(&canonical, HMACCanonicalRequest{
+		Method:    httpReq.Method,
+		Host:      httpReq.URL.Host,
+		Path:      httpReq.URL.EscapedPath(),
+		Query:     httpReq.URL.Query().Encode(),
+		BodyHash:  hex.EncodeToString(bodyHash.Sum(nil)),
+		Timestamp: timestamp,
+		header:    httpReq.Header,
+	}); err != nil {
+		return errors.Wrap(err, "rendering the canonical request")
+	}
+
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write([]byte(canonical.String()))
+
+	encode := hex.EncodeToString
+	if a.EncodeSignature != nil {
+		encode = a.EncodeSignature
+	}
+
+	httpReq.Header.Set(a.getSignatureHeader(), a.SignaturePrefix+encode(mac.Sum(nil)))
+	return nil
+}
+
+// readRequestBody returns the body of a request without consuming it.
+func readRequestBody(httpReq *http.Request) ([]byte, error) {
+	if httpReq.Body == nil || httpReq.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if httpReq.GetBody != nil {
+		body, err := httpReq.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+
+		return io.ReadAll(body)
+	}
+
+	b, err := io.ReadAll(httpReq.Body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Body.Close()
+
+	httpReq.Body = io.NopCloser(bytes.NewReader(b))
+	httpReq.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	return b, nil
+}
+
+// signRequest signs a fully built request if the provider's authenticator
+// is an HMACAuthenticator, since the request's path params and body are
+// only final once the request is validated.
+func (p *Provider) signRequest(httpReq *http.Request) error {
+	a, ok := p.getAuthenticator().(*HMACAuthenticator)
+	if !ok {
+		return nil
+	}
+
+	if err := a.sign(httpReq); err != nil {
+		return errors.Wrap(err, "signing request")
+	}
+
+	return nil
+}
+
+// signingTransport is an http.RoundTripper that signs the requests that
+// were signed by the provider's HMACAuthenticator again right before they
+// are sent, so that every attempt of a request has a fresh timestamp. It
+// is the innermost transport of the provider so that no transport changes
+// a request after it is signed.
+type signingTransport struct {
+	wrapped http.RoundTripper
+	// getAuthenticator returns the current authenticator of the provider.
+	// It is set once the provider is created.
+	getAuthenticator func() Authenticator
+}
+
+func (t *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.getAuthenticator == nil {
+		return t.wrapped.RoundTrip(req)
+	}
+
+	a, ok := t.getAuthenticator().(*HMACAuthenticator)
+	if !ok || !a.isSigned(req) {
+		return t.wrapped.RoundTrip(req)
+	}
+
+	signedReq := req.Clone(req.Context())
+	if err := a.sign(signedReq); err != nil {
+		return nil, errors.Wrap(err, "signing request")
+	}
+
+	return t.wrapped.RoundTrip(signedReq)
+}
@@ -0,0 +1,159 @@
+package rest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+
+	"github.com/cloudy-sky-software/pulumi-provider-framework/state"
+)
+
+// makeTestHMACServer returns a server that only accepts requests signed
+// with the default template and `secret` and records their timestamps.
+// The first request fails with a 503 response so that it is retried.
+func makeTestHMACServer(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var timestamps []string
+	var requestCount atomic.Int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		bodyHash := sha256.Sum256(body)
+		timestamp := r.Header.Get(headerTimestamp)
+		canonical := strings.Join([]string{r.Method, r.URL.EscapedPath(), r.URL.Query().Encode(), hex.EncodeToString(bodyHash[:]), timestamp}, "\n")
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(canonical))
+		if r.Header.Get(headerSignature) != hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		mu.Lock()
+		timestamps = append(timestamps, timestamp)
+		mu.Unlock()
+
+		if requestCount.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, `{"id":"fake-id","another_prop":"output value"}`)
+	}))
+
+	return testServer, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return timestamps
+	}
+}
+
+// newTestHMACAuthenticator returns an authenticator whose clock advances
+// by a second every time it is read.
+func newTestHMACAuthenticator() *HMACAuthenticator {
+	var seconds atomic.Int64
+	return &HMACAuthenticator{
+		Secret: StaticCredential("secret"),
+		Now: func() time.Time {
+			return time.Unix(1700000000+seconds.Add(1), 0)
+		},
+	}
+}
+
+func TestHMACAuthenticatorResignsRetries(t *testing.T) {
+	ctx := context.Background()
+
+	testServer, getTimestamps := makeTestHMACServer(t)
+	defer testServer.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+
+	p := makeTestGenericProviderWithOpts(ctx, t, testServer, nil, true,
+		WithRetryPolicy(policy),
+		WithAuthenticator(newTestHMACAuthenticator()),
+	)
+
+	readResp, err := readFakeResource(ctx, t, p)
+	require.NoError(t, err)
+	assert.Contains(t, readResp.GetProperties().AsMap(), "anotherProp")
+
+	timestamps := getTimestamps()
+	require.Len(t, timestamps, 2)
+	assert.NotEqual(t, timestamps[0], timestamps[1], "Expected the retry to be signed with a new timestamp")
+}
+
+func TestHMACAuthenticatorSignsRequestBody(t *testing.T) {
+	ctx := context.Background()
+
+	testServer, _ := makeTestHMACServer(t)
+	defer testServer.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+
+	p := makeTestGenericProviderWithOpts(ctx, t, testServer, nil, true,
+		WithRetryPolicy(policy),
+		WithIdempotencyKeys(""),
+		WithAuthenticator(newTestHMACAuthenticator()),
+	)
+
+	// The create is retried since it has an idempotency key.
+	props, err := plugin.MarshalProperties(checkFakeResource(ctx, t, p), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	_, err = p.Create(ctx, &pulumirpc.CreateRequest{
+		Name:       "myResource",
+		Properties: props,
+		Type:       fakeResourceTypeToken,
+		Urn:        "urn:pulumi:some-stack::some-project::" + fakeResourceTypeToken + "::myResource",
+	})
+	require.NoError(t, err)
+}
+
+func TestHMACAuthenticatorCustomTemplate(t *testing.T) {
+	ctx := context.Background()
+
+	a := &HMACAuthenticator{
+		Secret:          StaticCredential("secret"),
+		KeyID:           StaticCredential("key-1"),
+		KeyIDHeader:     "X-Key-Id",
+		Template:        `{{.Method}} {{.Host}}{{.Path}}?{{.Query}} {{.Header "X-Key-Id"}} {{.Timestamp}}`,
+		Hash:            sha512.New,
+		EncodeSignature: base64.StdEncoding.EncodeToString,
+		SignatureHeader: "Authorization",
+		SignaturePrefix: "HMAC ",
+		TimestampFormat: time.RFC3339,
+		Now: func() time.Time {
+			return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		},
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.example.com/things?b=2&a=1", nil)
+	require.NoError(t, err)
+	require.NoError(t, a.Authenticate(ctx, httpReq, nil))
+
+	mac := hmac.New(sha512.New, []byte("secret"))
+	mac.Write([]byte("GET api.example.com/things?a=1&b=2 key-1 2024-01-02T03:04:05Z"))
+	assert.Equal(t, fmt.Sprintf("HMAC %s", base64.StdEncoding.EncodeToString(mac.Sum(nil))), httpReq.Header.Get("Authorization"))
+	assert.Equal(t, "2024-01-02T03:04:05Z", httpReq.Header.Get(headerTimestamp))
+}
@@ -0,0 +1,76 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+
+	"github.com/cloudy-sky-software/pulumi-provider-framework/state"
+)
+
+// idempotencyKeyProperty is the input of a resource that holds the
+// idempotency key of its create request. It is set during Check and is
+// never sent to the API as part of a request body.
+const idempotencyKeyProperty resource.PropertyKey = "__idempotencyKey"
+
+// newIdempotencyKey returns the idempotency key of the create request of
+// a resource. The key is derived from the URN and the random seed sent by
+// the engine in Check so that it is the same when the engine retries the
+// creation of the resource, e.g. after a create request timed out.
+func newIdempotencyKey(urn string, randomSeed []byte) string {
+	data := append([]byte(urn), randomSeed...)
+	return uuid.NewSHA1(uuid.NameSpaceURL, data).String()
+}
+
+// setIdempotencyKey adds the idempotency key of the create request of a
+// resource to its inputs, if idempotency keys are enabled. No key is set
+// without a random seed, since the key would then be the same for every
+// replacement of the resource and the API would return the resource that
+// was replaced instead of creating a new one.
+func (p *Provider) setIdempotencyKey(inputs resource.PropertyMap, urn string, randomSeed []byte) {
+	if p.idempotencyKeyHeader == "" || len(randomSeed) == 0 {
+		return
+	}
+
+	inputs[idempotencyKeyProperty] = resource.NewStringProperty(newIdempotencyKey(urn, randomSeed))
+}
+
+// popIdempotencyKey removes the idempotency key from the inputs of a
+// resource and returns it.
+func popIdempotencyKey(inputs resource.PropertyMap) string {
+	v, ok := inputs[idempotencyKeyProperty]
+	if !ok {
+		return ""
+	}
+
+	delete(inputs, idempotencyKeyProperty)
+
+	v, known := unwrapPropertyValue(v)
+	if !known || !v.IsString() {
+		return ""
+	}
+
+	return v.StringValue()
+}
+
+// setIdempotencyKeyHeader sets the idempotency key header of a create
+// request, which also makes it safe for the retry transport to retry it.
+func (p *Provider) setIdempotencyKeyHeader(httpReq *http.Request, idempotencyKey string) {
+	if p.idempotencyKeyHeader == "" || idempotencyKey == "" || httpReq.Method != http.MethodPost {
+		return
+	}
+
+	httpReq.Header.Set(p.idempotencyKeyHeader, idempotencyKey)
+}
+
+// storeIdempotencyKey stores the idempotency key that a resource was
+// created with in its state.
+func storeIdempotencyKey(outputState resource.PropertyMap, idempotencyKey string) {
+	if idempotencyKey == "" {
+		return
+	}
+
+	state.SetIdempotencyKey(outputState, idempotencyKey)
+}
@@ -0,0 +1,201 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+
+	"github.com/cloudy-sky-software/pulumi-provider-framework/state"
+)
+
+const fakeResourceURN = "urn:pulumi:some-stack::some-project::" + fakeResourceTypeToken + "::myResource"
+
+// fakeRandomSeed is the random seed that the engine sends when it checks
+// the fake resource.
+var fakeRandomSeed = []byte("seed")
+
+func checkFakeResource(ctx context.Context, t *testing.T, p pulumirpc.ResourceProviderServer) resource.PropertyMap {
+	t.Helper()
+
+	checkResp, err := p.Check(ctx, &pulumirpc.CheckRequest{
+		Urn:        fakeResourceURN,
+		News:       getMarshaledProps(t, `{"simpleProp":"somevalue"}`),
+		RandomSeed: fakeRandomSeed,
+	})
+	require.NoError(t, err)
+
+	inputs, err := plugin.UnmarshalProperties(checkResp.GetInputs(), state.DefaultUnmarshalOpts)
+	require.NoError(t, err)
+
+	return inputs
+}
+
+func createFakeResourceWithIdempotencyKey(ctx context.Context, t *testing.T, p pulumirpc.ResourceProviderServer) resource.PropertyMap {
+	t.Helper()
+
+	props, err := plugin.MarshalProperties(checkFakeResource(ctx, t, p), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	createResp, err := p.Create(ctx, &pulumirpc.CreateRequest{
+		Name:       "myResource",
+		Properties: props,
+		Type:       fakeResourceTypeToken,
+		Urn:        fakeResourceURN,
+	})
+	require.NoError(t, err)
+
+	outputs, err := plugin.UnmarshalProperties(createResp.GetProperties(), state.DefaultUnmarshalOpts)
+	require.NoError(t, err)
+
+	return outputs
+}
+
+func TestCheckAddsIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+
+	p := makeTestGenericProviderWithOpts(ctx, t, nil, nil, true, WithIdempotencyKeys(""))
+
+	inputs := checkFakeResource(ctx, t, p)
+	require.Contains(t, inputs, idempotencyKeyProperty)
+	assert.Equal(t, newIdempotencyKey(fakeResourceURN, fakeRandomSeed), inputs[idempotencyKeyProperty].StringValue())
+	assert.NotEqual(t, newIdempotencyKey(fakeResourceURN, []byte("another seed")), inputs[idempotencyKeyProperty].StringValue())
+}
+
+func TestCheckDoesNotAddIdempotencyKeyWithoutRandomSeed(t *testing.T) {
+	ctx := context.Background()
+
+	p := makeTestGenericProviderWithOpts(ctx, t, nil, nil, true, WithIdempotencyKeys(""))
+
+	checkResp, err := p.Check(ctx, &pulumirpc.CheckRequest{
+		Urn:  fakeResourceURN,
+		News: getMarshaledProps(t, `{"simpleProp":"somevalue"}`),
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, checkResp.GetInputs().AsMap(), string(idempotencyKeyProperty))
+}
+
+func TestCheckDoesNotAddIdempotencyKeyByDefault(t *testing.T) {
+	ctx := context.Background()
+
+	p := makeTestGenericProvider(ctx, t, nil, nil)
+
+	assert.NotContains(t, checkFakeResource(ctx, t, p), idempotencyKeyProperty)
+}
+
+func TestCreateRetryReusesIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var keys []string
+	var body map[string]any
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		keys = append(keys, r.Header.Get("X-Request-Key"))
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if len(keys) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, `{"id":"fake-id","another_prop":"output value"}`)
+	}))
+	defer testServer.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+
+	p := makeTestGenericProviderWithOpts(ctx, t, testServer, nil, true,
+		WithRetryPolicy(policy),
+		WithIdempotencyKeys("X-Request-Key"),
+	)
+
+	outputs := createFakeResourceWithIdempotencyKey(ctx, t, p)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, keys, 2)
+	assert.Equal(t, newIdempotencyKey(fakeResourceURN, fakeRandomSeed), keys[0])
+	assert.Equal(t, keys[0], keys[1])
+	assert.Equal(t, keys[0], state.GetIdempotencyKey(outputs))
+	assert.NotContains(t, body, string(idempotencyKeyProperty))
+}
+
+func TestEngineRetryOfCreateReusesIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var keys []string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		keys = append(keys, r.Header.Get(headerIdempotencyKey))
+		_, _ = io.WriteString(w, `{"id":"fake-id","another_prop":"output value"}`)
+	}))
+	defer testServer.Close()
+
+	p := makeTestGenericProviderWithOpts(ctx, t, testServer, nil, true, WithIdempotencyKeys(""))
+
+	// The engine checks and creates the resource again with the same URN
+	// and random seed, e.g. after the first create request timed out.
+	createFakeResourceWithIdempotencyKey(ctx, t, p)
+	createFakeResourceWithIdempotencyKey(ctx, t, p)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, keys, 2)
+	assert.NotEmpty(t, keys[0])
+	assert.Equal(t, keys[0], keys[1])
+}
+
+func TestIdempotencyKeyIsExcludedFromDiff(t *testing.T) {
+	ctx := context.Background()
+
+	p := makeTestGenericProviderWithOpts(ctx, t, nil, nil, true, WithIdempotencyKeys(""))
+
+	diffResp, err := p.Diff(ctx, &pulumirpc.DiffRequest{
+		Id:        "fake-id",
+		OldInputs: getMarshaledProps(t, `{"simpleProp":"somevalue","__idempotencyKey":"key1"}`),
+		News:      getMarshaledProps(t, `{"simpleProp":"somevalue","__idempotencyKey":"key2"}`),
+		Urn:       fakeResourceURN,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, pulumirpc.DiffResponse_DIFF_NONE, diffResp.GetChanges())
+}
+
+func TestUpdateKeepsIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `{"id":"fake-id","another_prop":"output value"}`)
+	}))
+	defer testServer.Close()
+
+	p := makeTestGenericProviderWithOpts(ctx, t, testServer, nil, true, WithIdempotencyKeys(""))
+
+	updateResp, err := p.Update(ctx, &pulumirpc.UpdateRequest{
+		Id:        "fake-id",
+		Olds:      getMarshaledProps(t, `{"id":"fake-id","__idempotencyKey":"some-key"}`),
+		News:      getMarshaledProps(t, `{"simpleProp":"newvalue"}`),
+		OldInputs: getMarshaledProps(t, `{"simpleProp":"somevalue"}`),
+		Urn:       fakeResourceURN,
+	})
+	require.NoError(t, err)
+
+	outputs, err := plugin.UnmarshalProperties(updateResp.GetProperties(), state.DefaultUnmarshalOpts)
+	require.NoError(t, err)
+	assert.Equal(t, "some-key", state.GetIdempotencyKey(outputs))
+}
@@ -0,0 +1,39 @@
+package rest
+
+// FrameworkMetadata is the provider metadata understood by this framework
+// in addition to pulschema's ProviderMetadata. Providers include these
+// properties in the same metadata JSON document that is passed to
+// MakeProvider.
+type FrameworkMetadata struct {
+	// AsyncOperationMap is a map of resource type tokens to hints about
+	// how their mutating operations complete asynchronously.
+	AsyncOperationMap map[string]AsyncOperationHint `json:"asyncOperationMap,omitempty"`
+
+	// WaiterMap is a map of resource type tokens to the waiter used
+	// to determine when the resource is ready after it is created
+	// or updated.
+	WaiterMap map[string]WaiterHint `json:"waiterMap,omitempty"`
+
+	// NotFoundMap is a map of resource type tokens to the responses
+	// that indicate that the resource no longer exists.
+	NotFoundMap map[string]NotFoundHint `json:"notFoundMap,omitempty"`
+
+	// DeletionWaiterMap is a map of resource type tokens that opt-in
+	// to waiting until the resource can no longer be read after it
+	// is deleted.
+	DeletionWaiterMap map[string]DeletionWaiterHint `json:"deletionWaiterMap,omitempty"`
+
+	// ConcurrencyMap is a map of resource type tokens to the limit of
+	// their mutating operations that can be in flight at the same time.
+	ConcurrencyMap map[string]ConcurrencyHint `json:"concurrencyMap,omitempty"`
+
+	// OptimisticConcurrencyMap is a map of resource type tokens that
+	// opt-in to sending their updates and deletes with an If-Match
+	// header.
+	OptimisticConcurrencyMap map[string]OptimisticConcurrencyHint `json:"optimisticConcurrencyMap,omitempty"`
+
+	// PaginationMap is a map of list invoke type tokens to how the
+	// pages of the list are fetched, for lists whose pagination can't
+	// be detected from the OpenAPI doc.
+	PaginationMap map[string]PaginationHint `json:"paginationMap,omitempty"`
+}
@@ -0,0 +1,351 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/pkg/errors"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/logging"
+)
+
+const (
+	headerAuthorization = "Authorization"
+
+	// oauth2ExpiryDelta is how long before its expiry an access token is
+	// refreshed so that it doesn't expire while a request is in flight.
+	oauth2ExpiryDelta = 30 * time.Second
+
+	// oauth2TokenRequestTimeout bounds a token request, which outlives
+	// the request that started it if other requests wait for its token.
+	oauth2TokenRequestTimeout = time.Minute
+)
+
+// oauth2TokenSource gets access tokens with the OAuth2 client credentials
+// grant and caches them until they are about to expire.
+type oauth2TokenSource struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	httpClient   *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+	// refresh is the request for a new token that is in flight, if any.
+	refresh *oauth2TokenRefresh
+}
+
+// oauth2TokenRefresh is a request for a new access token that the callers
+// of getToken share.
+type oauth2TokenRefresh struct {
+	// done is closed once the request completes.
+	done  chan struct{}
+	token string
+	err   error
+}
+
+type oauth2TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	// ExpiresIn is the lifetime of the token in seconds. Some servers
+	// send it as a string.
+	ExpiresIn json.Number `json:"expires_in"`
+}
+
+// getToken returns the cached access token, or a new one if the cached
+// token is about to expire. Concurrent callers wait for the same token
+// request, which is sent without holding the lock, and stop waiting when
+// their ctx is done.
+func (s *oauth2TokenSource) getToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	if s.token != "" && (s.expiry.IsZero() || time.Now().Add(oauth2ExpiryDelta).Before(s.expiry)) {
+		token := s.token
+		s.mu.Unlock()
+		return token, nil
+	}
+
+	refresh := s.refresh
+	if refresh == nil {
+		refresh = &oauth2TokenRefresh{done: make(chan struct{})}
+		s.refresh = refresh
+
+		// The request is not canceled with ctx since other callers may
+		// be waiting for its token.
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), oauth2TokenRequestTimeout)
+		go func() {
+			defer cancel()
+			s.refreshToken(fetchCtx, refresh)
+		}()
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-refresh.done:
+		return refresh.token, refresh.err
+	}
+}
+
+// refreshToken fetches a new access token, caches it and shares it with
+// the callers waiting for refresh.
+func (s *oauth2TokenSource) refreshToken(ctx context.Context, refresh *oauth2TokenRefresh) {
+	token, expiry, err := s.fetchToken(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		s.token = token
+		s.expiry = expiry
+	}
+	s.refresh = nil
+
+	refresh.token = token
+	refresh.err = err
+	close(refresh.done)
+}
+
+// invalidate drops the cached access token if it is token so that the
+// next call to getToken fetches a new one.
+func (s *oauth2TokenSource) invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+func (s *oauth2TokenSource) fetchToken(ctx context.Context) (string, time.Time, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.scopes) > 0 {
+		form.Set("scope", strings.Join(s.scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "initializing oauth2 token request")
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", jsonMimeType)
+	// The client credentials are form-encoded before they are used as
+	// the basic auth credentials, per RFC 6749.
+	req.SetBasicAuth(url.QueryEscape(s.clientID), url.QueryEscape(s.clientSecret))
+
+	httpClient := s.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	logging.V(3).Infof("Requesting an oauth2 access token from %s", s.tokenURL)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "requesting oauth2 access token")
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "reading oauth2 token response")
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", time.Time{}, errors.Errorf("oauth2 token request to %s failed with status %d: %s", s.tokenURL, resp.StatusCode, string(body))
+	}
+
+	var tokenResp oauth2TokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "unmarshaling oauth2 token response")
+	}
+
+	if tokenResp.AccessToken == "" {
+		return "", time.Time{}, errors.Errorf("oauth2 token response from %s has no access token", s.tokenURL)
+	}
+
+	var expiry time.Time
+	if expiresIn, err := tokenResp.ExpiresIn.Int64(); err == nil && expiresIn > 0 {
+		expiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	}
+
+	return tokenResp.AccessToken, expiry, nil
+}
+
+// OAuth2Authenticator sends an access token of an OAuth2 client, which is
+// obtained with the client credentials grant and cached until it is about
+// to expire, as a bearer token.
+type OAuth2Authenticator struct {
+	source *oauth2TokenSource
+}
+
+// NewOAuth2Authenticator returns an authenticator that gets access tokens
+// with the given scopes from tokenURL. Token requests are sent with the
+// provider's HTTP client.
+func NewOAuth2Authenticator(tokenURL, clientID, clientSecret string, scopes ...string) *OAuth2Authenticator {
+	return &OAuth2Authenticator{
+		source: &oauth2TokenSource{
+			tokenURL:     tokenURL,
+			clientID:     clientID,
+			clientSecret: clientSecret,
+			scopes:       scopes,
+		},
+	}
+}
+
+// Authenticate implements Authenticator.
+func (a *OAuth2Authenticator) Authenticate(ctx context.Context, httpReq *http.Request, _ openapi3.SecurityRequirements) error {
+	token, err := a.source.getToken(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting oauth2 access token")
+	}
+
+	httpReq.Header.Set(headerAuthorization, bearerAuthSchemePrefix+" "+token)
+	return nil
+}
+
+// oauth2Transport is an http.RoundTripper that sends requests carrying a
+// bearer token with the current access token of the provider's OAuth2
+// authenticator, so that retries and polls outliving a token still
+// succeed. A request rejected with a 401 response is sent once more with
+// a new token in case the token was revoked before its expiry.
+type oauth2Transport struct {
+	wrapped http.RoundTripper
+	// getAuthenticator returns the current authenticator of the provider.
+	// It is set once the provider is created.
+	getAuthenticator func() Authenticator
+}
+
+// getTokenSource returns the token source of the provider's authenticator
+// if it is an OAuth2 authenticator.
+func (t *oauth2Transport) getTokenSource() *oauth2TokenSource {
+	if t.getAuthenticator == nil {
+		return nil
+	}
+
+	if a, ok := t.getAuthenticator().(*OAuth2Authenticator); ok {
+		return a.source
+	}
+
+	return nil
+}
+
+func (t *oauth2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	source := t.getTokenSource()
+	if source == nil || !strings.HasPrefix(req.Header.Get(headerAuthorization), bearerAuthSchemePrefix+" ") {
+		return t.wrapped.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	token, err := source.getToken(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting oauth2 access token")
+	}
+
+	resp, err := t.wrapped.RoundTrip(withBearerToken(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !canResendBody(req) {
+		return resp, err
+	}
+
+	logging.V(3).Infof("Received 401 response for %s %s. Refreshing the oauth2 access token...", req.Method, redactURL(req.URL))
+	source.invalidate(token)
+	token, err = source.getToken(ctx)
+	if err != nil {
+		return resp, nil
+	}
+
+	// Drain the body so that the connection can be reused.
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	retryReq := withBearerToken(req, token)
+	if req.GetBody != nil {
+		retryReq.Body, err = req.GetBody()
+		if err != nil {
+			return nil, errors.Wrap(err, "resetting request body")
+		}
+	}
+
+	return t.wrapped.RoundTrip(retryReq)
+}
+
+// withBearerToken returns a copy of req with token as its bearer token.
+func withBearerToken(req *http.Request, token string) *http.Request {
+	r := req.Clone(req.Context())
+	r.Header.Set(headerAuthorization, bearerAuthSchemePrefix+" "+token)
+	return r
+}
+
+// getOAuth2ClientCredentialsFlow returns the client credentials flow of
+// the first OAuth2 security scheme of the OpenAPI doc that has one.
+func (p *Provider) getOAuth2ClientCredentialsFlow() (*openapi3.OAuthFlow, bool) {
+	schemes := p.openAPIDoc.Components.SecuritySchemes
+	for _, name := range slices.Sorted(maps.Keys(schemes)) {
+		scheme := schemes[name].Value
+		if scheme == nil || !strings.EqualFold(scheme.Type, "oauth2") || scheme.Flows == nil || scheme.Flows.ClientCredentials == nil {
+			continue
+		}
+
+		return scheme.Flows.ClientCredentials, true
+	}
+
+	return nil, false
+}
+
+// configureOAuth2 sets up the OAuth2 authenticator of the provider config
+// if the provider config has client credentials. To set via pulumi config,
+// these are "providername:clientId" and "providername:clientSecret". The
+// token URL and the scopes of the access tokens are those of the client
+// credentials flow of the OpenAPI doc's securitySchemes. The scopes can be
+// overridden with "providername:scopes", a comma-separated list, which
+// requests no scope at all if empty.
+func (p *Provider) configureOAuth2(vars map[string]string, cfg *providerConfig) error {
+	clientID := vars[fmt.Sprintf("%s:config:clientId", p.name)]
+	clientSecret := vars[fmt.Sprintf("%s:config:clientSecret", p.name)]
+	if clientID == "" || clientSecret == "" {
+		return nil
+	}
+
+	flow, ok := p.getOAuth2ClientCredentialsFlow()
+	if !ok {
+		logging.V(3).Infof("The OpenAPI doc has no oauth2 client credentials flow, ignoring the clientId and clientSecret config")
+		return nil
+	}
+
+	base, err := url.Parse(cfg.baseURL)
+	if err != nil {
+		return errors.Wrapf(err, "parsing base url %s", cfg.baseURL)
+	}
+	tokenURL, err := base.Parse(flow.TokenURL)
+	if err != nil {
+		return errors.Wrapf(err, "parsing oauth2 token url %s", flow.TokenURL)
+	}
+
+	scopes := slices.Sorted(maps.Keys(flow.Scopes))
+	if v, ok := vars[fmt.Sprintf("%s:config:scopes", p.name)]; ok {
+		scopes = nil
+		for _, scope := range strings.Split(v, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	cfg.oauth2Authenticator = NewOAuth2Authenticator(tokenURL.String(), clientID, clientSecret, scopes...)
+	cfg.oauth2Authenticator.source.httpClient = p.httpClient
+
+	logging.V(3).Infof("OAuth2 client credentials: tokenUrl: %s, scopes: %v", tokenURL, scopes)
+	return nil
+}
@@ -0,0 +1,211 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+)
+
+const oauth2TokenPath = "/oauth/token"
+
+// makeTestOAuth2Server returns a server that issues the access tokens
+// `token1`, `token2`, ... and that only accepts API requests with the
+// latest token.
+func makeTestOAuth2Server(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var tokenCount atomic.Int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == oauth2TokenPath {
+			clientID, clientSecret, ok := r.BasicAuth()
+			if !ok || clientID != "client-id" || clientSecret != "client-secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			assert.Equal(t, "client_credentials", r.FormValue("grant_type"))
+			assert.Equal(t, "read write", r.FormValue("scope"))
+
+			_, _ = fmt.Fprintf(w, `{"access_token":"token%d","token_type":"bearer","expires_in":3600}`, tokenCount.Add(1))
+			return
+		}
+
+		if r.Header.Get(headerAuthorization) != fmt.Sprintf("Bearer token%d", tokenCount.Load()) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_, _ = io.WriteString(w, `{"id":"fake-id","another_prop":"output value"}`)
+	}))
+
+	return testServer, &tokenCount
+}
+
+func configureTestOAuth2(ctx context.Context, t *testing.T, p pulumirpc.ResourceProviderServer) {
+	t.Helper()
+
+	p.(*Provider).openAPIDoc.Components.SecuritySchemes["OAuth2"] = &openapi3.SecuritySchemeRef{
+		Value: &openapi3.SecurityScheme{
+			Type: "oauth2",
+			Flows: &openapi3.OAuthFlows{
+				ClientCredentials: &openapi3.OAuthFlow{
+					TokenURL: oauth2TokenPath,
+					Scopes:   map[string]string{"write": "", "read": ""},
+				},
+			},
+		},
+	}
+
+	_, err := p.Configure(ctx, &pulumirpc.ConfigureRequest{
+		Variables: map[string]string{
+			"generic:config:clientId":     "client-id",
+			"generic:config:clientSecret": "client-secret",
+		},
+		SendsOldInputs:         true,
+		SendsOldInputsToDelete: true,
+	})
+	require.NoError(t, err)
+}
+
+func TestOAuth2AccessTokenIsCached(t *testing.T) {
+	ctx := context.Background()
+
+	testServer, tokenCount := makeTestOAuth2Server(t)
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	configureTestOAuth2(ctx, t, p)
+
+	for range 3 {
+		_, err := readFakeResource(ctx, t, p)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), tokenCount.Load())
+}
+
+func TestOAuth2AccessTokenIsRefreshedBeforeExpiry(t *testing.T) {
+	ctx := context.Background()
+
+	testServer, tokenCount := makeTestOAuth2Server(t)
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	configureTestOAuth2(ctx, t, p)
+
+	_, err := readFakeResource(ctx, t, p)
+	require.NoError(t, err)
+
+	// The token is about to expire.
+	source := p.(*Provider).config().oauth2Authenticator.source
+	source.expiry = time.Now().Add(oauth2ExpiryDelta / 2)
+
+	_, err = readFakeResource(ctx, t, p)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), tokenCount.Load())
+}
+
+func TestOAuth2AccessTokenIsRefreshedOn401(t *testing.T) {
+	ctx := context.Background()
+
+	testServer, tokenCount := makeTestOAuth2Server(t)
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	configureTestOAuth2(ctx, t, p)
+
+	_, err := readFakeResource(ctx, t, p)
+	require.NoError(t, err)
+
+	// Revoke the cached token.
+	tokenCount.Add(1)
+
+	readResp, err := readFakeResource(ctx, t, p)
+	require.NoError(t, err)
+	assert.Contains(t, readResp.GetProperties().AsMap(), "anotherProp")
+	assert.Equal(t, int32(3), tokenCount.Load())
+}
+
+func TestOAuth2TokenRequestFailure(t *testing.T) {
+	ctx := context.Background()
+
+	testServer, _ := makeTestOAuth2Server(t)
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	configureTestOAuth2(ctx, t, p)
+	p.(*Provider).config().oauth2Authenticator.source.clientSecret = "wrong-secret"
+
+	_, err := readFakeResource(ctx, t, p)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "oauth2 token request")
+}
+
+func TestOAuth2ScopesConfigOverridesFlowScopes(t *testing.T) {
+	ctx := context.Background()
+
+	p := makeTestGenericProvider(ctx, t, nil, nil)
+	configureTestOAuth2(ctx, t, p)
+	assert.Equal(t, []string{"read", "write"}, p.(*Provider).config().oauth2Authenticator.source.scopes)
+
+	for scopes, expected := range map[string][]string{"read": {"read"}, "": nil} {
+		_, err := p.Configure(ctx, &pulumirpc.ConfigureRequest{
+			Variables: map[string]string{
+				"generic:config:clientId":     "client-id",
+				"generic:config:clientSecret": "client-secret",
+				"generic:config:scopes":       scopes,
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, expected, p.(*Provider).config().oauth2Authenticator.source.scopes)
+	}
+}
+
+func TestOAuth2ConcurrentCallersShareTokenRequest(t *testing.T) {
+	var tokenCount atomic.Int32
+	release := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		_, _ = fmt.Fprintf(w, `{"access_token":"token%d","expires_in":3600}`, tokenCount.Add(1))
+	}))
+	defer testServer.Close()
+
+	a := NewOAuth2Authenticator(testServer.URL, "client-id", "client-secret")
+
+	// A caller whose ctx is done stops waiting for the token while it is
+	// being requested, without blocking the other callers.
+	canceledCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 3)
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := a.source.getToken(context.Background())
+			assert.NoError(t, err)
+			tokens[i] = token
+		}()
+	}
+
+	_, err := a.source.getToken(canceledCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, []string{"token1", "token1", "token1"}, tokens)
+	assert.Equal(t, int32(1), tokenCount.Load())
+}
@@ -0,0 +1,217 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/pkg/errors"
+)
+
+// Option configures the provider returned by MakeProvider.
+type Option func(*providerOptions)
+
+// TransportMiddleware wraps the transport used to send HTTP requests
+// to the API.
+type TransportMiddleware func(http.RoundTripper) http.RoundTripper
+
+type providerOptions struct {
+	httpClient  *http.Client
+	middlewares []TransportMiddleware
+	baseURL     string
+	retryPolicy *RetryPolicy
+	rateLimits  []RateLimitRule
+	userAgent   string
+	router      routers.Router
+
+	concurrencyHint *ConcurrencyHint
+
+	idempotencyKeyHeader string
+
+	authenticator Authenticator
+}
+
+// WithHTTPClient sets the HTTP client used to send requests to the API.
+// The client is copied and its transport, or http.DefaultTransport if it
+// is nil, is wrapped with the provider's retry transport and any
+// middleware set with WithTransportMiddleware.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *providerOptions) {
+		o.httpClient = client
+	}
+}
+
+// WithTransportMiddleware adds a middleware to the transport used to send
+// requests to the API. Middlewares run for every attempt of a request,
+// including retries, in the order in which they are added.
+func WithTransportMiddleware(middleware TransportMiddleware) Option {
+	return func(o *providerOptions) {
+		o.middlewares = append(o.middlewares, middleware)
+	}
+}
+
+// WithBaseURL sets the base URL of the API instead of using the first
+// server in the OpenAPI doc.
+func WithBaseURL(baseURL string) Option {
+	return func(o *providerOptions) {
+		o.baseURL = baseURL
+	}
+}
+
+// WithRetryPolicy sets the policy used to retry requests that fail with
+// a transient error. The policy can still be overridden by the provider
+// config.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *providerOptions) {
+		o.retryPolicy = &policy
+	}
+}
+
+// WithRateLimits paces the requests sent to the API according to the
+// given rules, so that they stay within the API's rate limits instead of
+// being refused. The rules can be replaced by the provider config.
+func WithRateLimits(rules ...RateLimitRule) Option {
+	return func(o *providerOptions) {
+		o.rateLimits = append(o.rateLimits, rules...)
+	}
+}
+
+// WithUserAgent sets the User-Agent header of the requests sent to the
+// API unless the request already has one.
+func WithUserAgent(userAgent string) Option {
+	return func(o *providerOptions) {
+		o.userAgent = userAgent
+	}
+}
+
+// WithRouter sets the router used to find the OpenAPI operation of a
+// request. By default, a router is created from the OpenAPI doc when the
+// provider is configured.
+func WithRouter(router routers.Router) Option {
+	return func(o *providerOptions) {
+		o.router = router
+	}
+}
+
+// WithConcurrencyLimit limits the number of mutating operations of
+// every resource type that are in flight at the same time. A limit set
+// for a resource type in the metadata takes precedence.
+func WithConcurrencyLimit(hint ConcurrencyHint) Option {
+	return func(o *providerOptions) {
+		o.concurrencyHint = &hint
+	}
+}
+
+// WithIdempotencyKeys sends an idempotency key with the POST requests that
+// create resources, in the given header or `Idempotency-Key` if empty, so
+// that a create that is retried does not create a duplicate resource.
+// The key is derived from the resource's URN and the random seed that the
+// engine sends in Check, so the engine's own retries of a create send the
+// same key. No key is sent if the engine sends no random seed.
+// Requests with an idempotency key are retried by the retry transport like
+// idempotent ones.
+func WithIdempotencyKeys(header string) Option {
+	return func(o *providerOptions) {
+		if header == "" {
+			header = headerIdempotencyKey
+		}
+		o.idempotencyKeyHeader = header
+	}
+}
+
+// WithAuthenticator sets the authenticator that adds credentials to the
+// requests sent to the API instead of the authorization header returned
+// by the provider callback. It takes precedence over the OAuth2 client
+// credentials of the provider config.
+func WithAuthenticator(authenticator Authenticator) Option {
+	return func(o *providerOptions) {
+		o.authenticator = authenticator
+	}
+}
+
+// userAgentTransport is an http.RoundTripper that sets the User-Agent
+// header of requests that don't have one.
+type userAgentTransport struct {
+	wrapped   http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+
+	return t.wrapped.RoundTrip(req)
+}
+
+// httpTransports are the transports of the provider's HTTP client that
+// depend on the state of the provider.
+type httpTransports struct {
+	retry     *retryTransport
+	rateLimit *rateLimitTransport
+	oauth2    *oauth2Transport
+	signing   *signingTransport
+}
+
+// newHTTPClient returns the HTTP client used by the provider along with
+// its transports.
+func newHTTPClient(opts providerOptions) (*http.Client, httpTransports) {
+	var httpClient http.Client
+	var baseTransport http.RoundTripper
+	if opts.httpClient != nil {
+		httpClient = *opts.httpClient
+		baseTransport = httpClient.Transport
+		if baseTransport == nil {
+			baseTransport = http.DefaultTransport
+		}
+	} else {
+		httpClient.CheckRedirect = func(_ *http.Request, _ []*http.Request) error {
+			return errors.New("unable to handle redirects")
+		}
+		baseTransport = defaultTransport()
+	}
+
+	// Requests are signed last, after the middlewares have changed them.
+	signing := &signingTransport{wrapped: baseTransport}
+	baseTransport = signing
+
+	// Apply the middlewares in reverse so that the first one added
+	// is the outermost.
+	for i := len(opts.middlewares) - 1; i >= 0; i-- {
+		baseTransport = opts.middlewares[i](baseTransport)
+	}
+
+	// Every attempt of a request is paced by the rate limits.
+	rateLimit := newRateLimitTransport(baseTransport, opts.rateLimits)
+
+	policy := DefaultRetryPolicy()
+	if opts.retryPolicy != nil {
+		policy = *opts.retryPolicy
+	}
+	if opts.idempotencyKeyHeader != "" {
+		policy.IdempotencyKeyHeader = opts.idempotencyKeyHeader
+	}
+
+	// Every attempt of a request is sent with the current access token.
+	oauth2 := &oauth2Transport{wrapped: rateLimit}
+
+	retry := &retryTransport{
+		wrapped: oauth2,
+		policy:  policy,
+	}
+
+	httpClient.Transport = retry
+	if opts.userAgent != "" {
+		httpClient.Transport = &userAgentTransport{
+			wrapped:   retry,
+			userAgent: opts.userAgent,
+		}
+	}
+
+	return &httpClient, httpTransports{
+		retry:     retry,
+		rateLimit: rateLimit,
+		oauth2:    oauth2,
+		signing:   signing,
+	}
+}
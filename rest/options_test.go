@@ -0,0 +1,101 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func readFakeResource(ctx context.Context, t *testing.T, p pulumirpc.ResourceProviderServer) (*pulumirpc.ReadResponse, error) {
+	t.Helper()
+
+	return p.Read(ctx, &pulumirpc.ReadRequest{
+		Id:  "/fake-id",
+		Urn: "urn:pulumi:some-stack::some-project::" + fakeResourceTypeToken + "::myResource",
+	})
+}
+
+func TestProviderOptions(t *testing.T) {
+	ctx := context.Background()
+
+	var requestCount atomic.Int32
+	var userAgent string
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		if requestCount.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, `{"another_prop":"output value"}`)
+	}))
+	defer testServer.Close()
+
+	var middlewareCalls []string
+	middleware := func(name string) TransportMiddleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				middlewareCalls = append(middlewareCalls, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+
+	p := makeTestGenericProviderWithOpts(ctx, t, nil, nil, true,
+		WithBaseURL(testServer.URL),
+		WithHTTPClient(&http.Client{Timeout: 10 * time.Second}),
+		WithRetryPolicy(policy),
+		WithUserAgent("pulumi-generic/1.0.0"),
+		WithTransportMiddleware(middleware("first")),
+		WithTransportMiddleware(middleware("second")),
+	)
+
+	readResp, err := readFakeResource(ctx, t, p)
+	require.NoError(t, err)
+	assert.Contains(t, readResp.GetProperties().AsMap(), "anotherProp")
+
+	assert.Equal(t, testServer.URL, p.(*Provider).GetBaseURL())
+	assert.Equal(t, 10*time.Second, p.(*Provider).httpClient.Timeout)
+	assert.Equal(t, time.Millisecond, p.(*Provider).retryTransport.policy.InitialBackoff)
+	assert.Equal(t, "pulumi-generic/1.0.0", userAgent)
+	// The middlewares run for each attempt of the request.
+	assert.Equal(t, []string{"first", "second", "first", "second"}, middlewareCalls)
+}
+
+func TestWithRouter(t *testing.T) {
+	ctx := context.Background()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `{"another_prop":"output value"}`)
+	}))
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil).(*Provider)
+	router, err := gorillamux.NewRouter(&p.openAPIDoc)
+	require.NoError(t, err)
+
+	p = makeTestGenericProviderWithOpts(ctx, t, testServer, nil, true, WithRouter(router)).(*Provider)
+	assert.Same(t, router, p.config().router, "Expected the router to not be re-created when the provider is configured")
+
+	_, err = readFakeResource(ctx, t, p)
+	require.NoError(t, err)
+}
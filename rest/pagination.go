@@ -0,0 +1,595 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/pkg/errors"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/logging"
+)
+
+// PaginationStyle is the way in which an API returns the pages of a list.
+type PaginationStyle string
+
+const (
+	// PaginationStyleLink follows the `rel="next"` URL of the RFC 5988
+	// Link response header.
+	PaginationStyleLink PaginationStyle = "link"
+	// PaginationStyleCursor sends the cursor or next token of the
+	// previous page's response body in a query param.
+	PaginationStyleCursor PaginationStyle = "cursor"
+	// PaginationStyleOffset increments an offset query param by the
+	// number of items of the previous page.
+	PaginationStyleOffset PaginationStyle = "offset"
+	// PaginationStylePage increments a page number query param.
+	PaginationStylePage PaginationStyle = "page"
+)
+
+const (
+	headerLink = "Link"
+
+	// maxItemsArg is the invoke argument that caps the number of items
+	// returned by a list invoke.
+	maxItemsArg resource.PropertyKey = "maxItems"
+
+	// maxPages guards against APIs that never stop returning a next
+	// page.
+	maxPages = 1000
+)
+
+var (
+	cursorParamNames     = []string{"cursor", "next_token", "nextToken", "page_token", "pageToken", "continuation_token", "continuationToken", "starting_after", "after", "marker"}
+	nextCursorProperties = []string{"next_cursor", "nextCursor", "next_token", "nextToken", "next_page_token", "nextPageToken", "continuation_token", "continuationToken", "next_marker", "nextMarker", "cursor", "next"}
+)
+
+// PaginationHint declares how the pages of a list invoke are fetched.
+// Without a hint, only the pagination that the response of the first page
+// confirms is detected: a `rel="next"` Link header, or a next cursor in
+// the response body of a list endpoint with a cursor query param. Offset
+// and page number pagination always require a hint.
+type PaginationHint struct {
+	// Style is the way in which the API returns the pages of the list.
+	Style PaginationStyle `json:"style"`
+	// ItemsProperty is the property of the response body that holds the
+	// items of a page. Nested properties can be separated by a `.`. If
+	// empty, the response body itself or its only array property is used.
+	ItemsProperty string `json:"itemsProperty,omitempty"`
+
+	// CursorParam is the query param in which the cursor of the next page
+	// is sent when Style is PaginationStyleCursor.
+	CursorParam string `json:"cursorParam,omitempty"`
+	// NextCursorProperty is the property of the response body that holds
+	// the cursor of the next page when Style is PaginationStyleCursor.
+	// Nested properties can be separated by a `.`. A cursor that is an
+	// absolute URL is followed like a Link header.
+	NextCursorProperty string `json:"nextCursorProperty,omitempty"`
+
+	// OffsetParam is the query param of the offset of a page when Style is
+	// PaginationStyleOffset.
+	OffsetParam string `json:"offsetParam,omitempty"`
+	// PageParam is the query param of the page number when Style is
+	// PaginationStylePage.
+	PageParam string `json:"pageParam,omitempty"`
+	// PageSizeParam is the query param of the number of items per page.
+	PageSizeParam string `json:"pageSizeParam,omitempty"`
+	// PageSize is the number of items requested per page. The API's
+	// default is used if this is 0.
+	PageSize int `json:"pageSize,omitempty"`
+}
+
+// getPaginationHint returns the pagination hint of a list invoke from the
+// metadata, if any.
+func (p *Provider) getPaginationHint(invokeTypeToken string) (PaginationHint, bool) {
+	hint, ok := p.frameworkMetadata.PaginationMap[invokeTypeToken]
+	return hint, ok
+}
+
+// detectPaginationHint detects the pagination of a list invoke without a
+// hint from the response of its first page. The query params of the list
+// endpoint alone don't tell since params such as `after` or `marker` are
+// often filters whose values must not be replaced.
+func (p *Provider) detectPaginationHint(httpEndpointPath string, httpResp *http.Response, body interface{}) (PaginationHint, bool) {
+	if getNextLink(httpResp.Header) != "" {
+		return PaginationHint{Style: PaginationStyleLink}, true
+	}
+
+	cursorParam := findParamName(p.getQueryParams(httpEndpointPath), cursorParamNames)
+	if cursorParam != "" && getNextCursor(body, "") != "" {
+		return PaginationHint{Style: PaginationStyleCursor, CursorParam: cursorParam}, true
+	}
+
+	return PaginationHint{}, false
+}
+
+// getQueryParams returns the query params of the GET operation of an
+// endpoint keyed by name.
+func (p *Provider) getQueryParams(httpEndpointPath string) map[string]*openapi3.Parameter {
+	params := make(map[string]*openapi3.Parameter)
+	for _, param := range p.getOperationParams(httpEndpointPath, http.MethodGet) {
+		if param.Value != nil && param.Value.In == openapi3.ParameterInQuery {
+			params[param.Value.Name] = param.Value
+		}
+	}
+
+	return params
+}
+
+func findParamName(params map[string]*openapi3.Parameter, names []string) string {
+	for _, name := range names {
+		if _, ok := params[name]; ok {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// isListInvoke returns true if an invoke lists resources.
+func isListInvoke(invokeTypeToken string) bool {
+	return strings.Contains(invokeTypeToken, ":list")
+}
+
+// setPageSize sets the page size query param of the request for the
+// first page of a list, if the pagination hint of the list has one.
+func (p *Provider) setPageSize(invokeTypeToken string, httpReq *http.Request) {
+	hint, ok := p.getPaginationHint(invokeTypeToken)
+	if !ok || hint.PageSize <= 0 || hint.PageSizeParam == "" {
+		return
+	}
+
+	query := httpReq.URL.Query()
+	query.Set(hint.PageSizeParam, strconv.Itoa(hint.PageSize))
+	httpReq.URL.RawQuery = query.Encode()
+}
+
+// popMaxItems removes the max items argument from the args of a list
+// invoke and returns it, or 0 if there is no cap.
+func popMaxItems(args resource.PropertyMap) (int, error) {
+	v, ok := args[maxItemsArg]
+	if !ok {
+		return 0, nil
+	}
+
+	delete(args, maxItemsArg)
+
+	v, known := unwrapPropertyValue(v)
+	if !known || v.IsNull() {
+		return 0, nil
+	}
+	if !v.IsNumber() || v.NumberValue() < 0 {
+		return 0, errors.Errorf("%s must be a non-negative number", maxItemsArg)
+	}
+
+	return int(v.NumberValue()), nil
+}
+
+// fetchRemainingPages fetches the pages of a list that follow the first
+// page, httpResp, whose response body is outputs, and returns the first
+// page with the items of all pages. maxItems caps the number of items if
+// it is greater than 0.
+func (p *Provider) fetchRemainingPages(ctx context.Context, invokeTypeToken, httpEndpointPath string, httpReq *http.Request, httpResp *http.Response, outputs interface{}, maxItems int) (interface{}, error) {
+	hint, ok := p.getPaginationHint(invokeTypeToken)
+	if !ok {
+		hint, ok = p.detectPaginationHint(httpEndpointPath, httpResp, outputs)
+	}
+	if !ok {
+		logging.V(3).Infof("The response of %s is not paginated or has no pagination hint, only its first page is returned", invokeTypeToken)
+		return outputs, nil
+	}
+
+	itemsPath, ok := getItemsPath(outputs, hint.ItemsProperty)
+	if !ok {
+		logging.V(3).Infof("Could not find the items of %s in its response, only its first page is returned", invokeTypeToken)
+		return outputs, nil
+	}
+
+	pager := listPager{
+		hint:      hint,
+		pageSize:  hint.PageSize,
+		firstPage: getFirstPage(p.getQueryParams(httpEndpointPath)[hint.PageParam]),
+	}
+	if pager.pageSize == 0 && hint.PageSizeParam != "" {
+		pager.pageSize, _ = strconv.Atoi(httpReq.URL.Query().Get(hint.PageSizeParam))
+	}
+
+	items, _ := getPageItems(outputs, itemsPath)
+
+	pageReq := httpReq
+	pageResp := httpResp
+	pageBody := outputs
+	pageItems := items
+	for range maxPages {
+		if len(pageItems) == 0 || (maxItems > 0 && len(items) >= maxItems) {
+			break
+		}
+
+		nextURL, err := pager.getNextPageURL(pageReq, pageResp, pageBody, len(pageItems))
+		if err != nil {
+			return nil, err
+		}
+		if nextURL == nil || nextURL.String() == pageReq.URL.String() {
+			break
+		}
+
+		pageReq = httpReq.Clone(ctx)
+		pageReq.URL = nextURL
+		pageReq.Host = ""
+
+		// The next URL replaces the query of the request, which can hold
+		// credentials such as an API key.
+		if err := p.authenticate(ctx, pageReq, p.getSecurityRequirements(httpEndpointPath, http.MethodGet)); err != nil {
+			return nil, err
+		}
+
+		logging.V(3).Infof("Fetching the next page of %s: %s", invokeTypeToken, redactURL(nextURL))
+		pageResp, pageBody, err = p.getPage(pageReq)
+		if err != nil {
+			return nil, err
+		}
+
+		nextItems, ok := getPageItems(pageBody, itemsPath)
+		if !ok {
+			return nil, errors.Errorf("page %s of %s has no items", redactURL(nextURL), invokeTypeToken)
+		}
+
+		// An API that ignores the pagination params returns the same
+		// page again instead of the next one.
+		if len(nextItems) > 0 && reflect.DeepEqual(nextItems[0], pageItems[0]) {
+			logging.V(3).Infof("Page %s of %s repeats the previous page, stopping", redactURL(nextURL), invokeTypeToken)
+			break
+		}
+
+		pageItems = nextItems
+		items = append(items, pageItems...)
+	}
+
+	if maxItems > 0 && len(items) > maxItems {
+		items = items[:maxItems]
+	}
+
+	return setPageItems(outputs, itemsPath, items), nil
+}
+
+// listPager computes the URLs of the pages of a list.
+type listPager struct {
+	hint PaginationHint
+	// pageSize is the number of items per page, or 0 if unknown.
+	pageSize int
+	// firstPage is the number of the page returned when the page param
+	// is not sent.
+	firstPage int
+}
+
+// getNextPageURL returns the URL of the page that follows the page
+// returned by pageReq, or nil if it is the last page.
+func (l listPager) getNextPageURL(pageReq *http.Request, pageResp *http.Response, pageBody interface{}, itemCount int) (*url.URL, error) {
+	hint := l.hint
+	switch hint.Style {
+	case PaginationStyleLink:
+		next := getNextLink(pageResp.Header)
+		if next == "" {
+			return nil, nil
+		}
+
+		return resolvePageURL(pageReq.URL, next)
+	case PaginationStyleCursor:
+		cursor := getNextCursor(pageBody, hint.NextCursorProperty)
+		if cursor == "" || cursor == pageReq.URL.Query().Get(hint.CursorParam) {
+			return nil, nil
+		}
+
+		if strings.HasPrefix(cursor, "http://") || strings.HasPrefix(cursor, "https://") {
+			return resolvePageURL(pageReq.URL, cursor)
+		}
+
+		if hint.CursorParam == "" {
+			return nil, errors.New("cursor pagination requires a cursor param")
+		}
+
+		return withQueryParams(pageReq.URL, hint, hint.CursorParam, cursor), nil
+	case PaginationStyleOffset:
+		if l.isLastPage(itemCount) {
+			return nil, nil
+		}
+
+		offset, _ := strconv.Atoi(pageReq.URL.Query().Get(hint.OffsetParam))
+		return withQueryParams(pageReq.URL, hint, hint.OffsetParam, strconv.Itoa(offset+itemCount)), nil
+	case PaginationStylePage:
+		if l.isLastPage(itemCount) {
+			return nil, nil
+		}
+
+		page, err := strconv.Atoi(pageReq.URL.Query().Get(hint.PageParam))
+		if err != nil {
+			page = l.firstPage
+		}
+
+		return withQueryParams(pageReq.URL, hint, hint.PageParam, strconv.Itoa(page+1)), nil
+	default:
+		return nil, errors.Errorf("unknown pagination style %q", hint.Style)
+	}
+}
+
+// isLastPage returns true if a page of an offset or page number list has
+// fewer items than a full page.
+func (l listPager) isLastPage(itemCount int) bool {
+	return itemCount == 0 || (l.pageSize > 0 && itemCount < l.pageSize)
+}
+
+// getFirstPage returns the number of the page that an API returns when
+// the page param is not sent, which is the default of the param or 1.
+func getFirstPage(param *openapi3.Parameter) int {
+	if param == nil || param.Schema == nil || param.Schema.Value == nil {
+		return 1
+	}
+
+	if page, ok := param.Schema.Value.Default.(float64); ok {
+		return int(page)
+	}
+
+	return 1
+}
+
+// withQueryParams returns a copy of u with the query param name set to
+// value, and the page size param set to the hint's page size.
+func withQueryParams(u *url.URL, hint PaginationHint, name, value string) *url.URL {
+	next := *u
+	query := next.Query()
+	query.Set(name, value)
+	if hint.PageSize > 0 && hint.PageSizeParam != "" {
+		query.Set(hint.PageSizeParam, strconv.Itoa(hint.PageSize))
+	}
+	next.RawQuery = query.Encode()
+
+	return &next
+}
+
+// resolvePageURL resolves the URL of the next page relative to the URL of
+// the current page. Pages on another host are not followed since the
+// request carries the provider's credentials.
+func resolvePageURL(current *url.URL, next string) (*url.URL, error) {
+	nextURL, err := current.Parse(next)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing next page url %q", next)
+	}
+
+	if !strings.EqualFold(nextURL.Host, current.Host) {
+		return nil, errors.Errorf("next page %s is not on the API host %s", nextURL, current.Host)
+	}
+
+	return nextURL, nil
+}
+
+// getNextLink returns the URL of the `rel="next"` link of an RFC 5988
+// Link header, e.g. `<https://api.example.com/items?page=2>; rel="next"`.
+func getNextLink(h http.Header) string {
+	for _, header := range h.Values(headerLink) {
+		for _, link := range parseLinkHeader(header) {
+			for _, rel := range strings.Fields(link.rel) {
+				if strings.EqualFold(rel, "next") {
+					return link.target
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// headerLinkValue is a link of a Link header.
+type headerLinkValue struct {
+	target string
+	rel    string
+}
+
+// parseLinkHeader parses the links of a Link header. Since the target of
+// a link and the quoted values of its params can contain commas and
+// semicolons, the header is not split on them.
+func parseLinkHeader(header string) []headerLinkValue {
+	var links []headerLinkValue
+	rest := header
+	for {
+		start := strings.IndexByte(rest, '<')
+		if start < 0 {
+			return links
+		}
+		end := strings.IndexByte(rest[start:], '>')
+		if end < 0 {
+			return links
+		}
+
+		link := headerLinkValue{target: strings.TrimSpace(rest[start+1 : start+end])}
+		rest = rest[start+end+1:]
+
+		for {
+			rest = strings.TrimLeft(rest, " \t")
+			if !strings.HasPrefix(rest, ";") {
+				break
+			}
+
+			var name, value string
+			name, value, rest = parseLinkParam(rest[1:])
+			if strings.EqualFold(name, "rel") {
+				link.rel = value
+			}
+		}
+
+		links = append(links, link)
+
+		next := strings.IndexByte(rest, ',')
+		if next < 0 {
+			return links
+		}
+		rest = rest[next+1:]
+	}
+}
+
+// parseLinkParam parses a `name=value` param of a link, whose value can
+// be a quoted string, and returns the rest of the header after it.
+func parseLinkParam(s string) (string, string, string) {
+	i := strings.IndexAny(s, "=;,")
+	if i < 0 {
+		return strings.TrimSpace(s), "", ""
+	}
+
+	name := strings.TrimSpace(s[:i])
+	if s[i] != '=' {
+		return name, "", s[i:]
+	}
+
+	s = strings.TrimLeft(s[i+1:], " \t")
+	if !strings.HasPrefix(s, `"`) {
+		i = strings.IndexAny(s, ";,")
+		if i < 0 {
+			return name, strings.TrimSpace(s), ""
+		}
+		return name, strings.TrimSpace(s[:i]), s[i:]
+	}
+
+	var value strings.Builder
+	for i = 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				value.WriteByte(s[i])
+			}
+		case '"':
+			return name, value.String(), s[i+1:]
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+
+	return name, value.String(), ""
+}
+
+// getNextCursor returns the cursor of the next page from the response
+// body of a page.
+func getNextCursor(body interface{}, nextCursorProperty string) string {
+	if nextCursorProperty != "" {
+		v, _ := lookupJSONPointer(body, dotPathToJSONPointer(nextCursorProperty))
+		return cursorString(v)
+	}
+
+	bodyMap, ok := body.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	for _, name := range nextCursorProperties {
+		if v, ok := bodyMap[name]; ok {
+			return cursorString(v)
+		}
+		if v, _, ok := tryPluckingProp(name, bodyMap); ok {
+			return cursorString(v)
+		}
+	}
+
+	return ""
+}
+
+func cursorString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// getItemsPath returns the JSON pointer of the items of a page.
+func getItemsPath(body interface{}, itemsProperty string) (string, bool) {
+	if itemsProperty != "" {
+		pointer := dotPathToJSONPointer(itemsProperty)
+		_, ok := getPageItems(body, pointer)
+		return pointer, ok
+	}
+
+	switch body := body.(type) {
+	case []interface{}:
+		return "", true
+	case map[string]interface{}:
+		var path string
+		for k, v := range body {
+			if _, ok := v.([]interface{}); !ok {
+				continue
+			}
+			// The items are ambiguous if there are several arrays.
+			if path != "" {
+				return "", false
+			}
+			path = "/" + strings.ReplaceAll(strings.ReplaceAll(k, "~", "~0"), "/", "~1")
+		}
+
+		return path, path != ""
+	default:
+		return "", false
+	}
+}
+
+func getPageItems(body interface{}, itemsPath string) ([]interface{}, bool) {
+	v, ok := lookupJSONPointer(body, itemsPath)
+	if !ok {
+		return nil, false
+	}
+
+	items, ok := v.([]interface{})
+	return items, ok
+}
+
+// setPageItems returns body with the items at itemsPath replaced.
+func setPageItems(body interface{}, itemsPath string, items []interface{}) interface{} {
+	if itemsPath == "" {
+		return items
+	}
+
+	i := strings.LastIndex(itemsPath, "/")
+	parent, _ := lookupJSONPointer(body, itemsPath[:i])
+	if m, ok := parent.(map[string]interface{}); ok {
+		m[unescapeJSONPointerToken(itemsPath[i+1:])] = items
+	}
+
+	return body
+}
+
+func dotPathToJSONPointer(path string) string {
+	return "/" + strings.ReplaceAll(path, ".", "/")
+}
+
+// getPage sends the request for a page of a list and returns its
+// unmarshaled response body.
+func (p *Provider) getPage(httpReq *http.Request) (*http.Response, interface{}, error) {
+	httpResp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "executing http request")
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "reading response body")
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, nil, p.newAPIError(httpReq, httpResp, body)
+	}
+
+	var page interface{}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, nil, errors.Wrapf(err, "unmarshaling the response of %s", redactURL(httpReq.URL))
+	}
+
+	return httpResp, page, nil
+}
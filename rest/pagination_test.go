@@ -0,0 +1,303 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+
+	"github.com/cloudy-sky-software/pulumi-provider-framework/state"
+)
+
+const (
+	listKeysTypeToken = "tailscale-native:tailnet:listKeys"
+	listKeysPath      = "/tailnet/{tailnet}/keys"
+)
+
+// selfConvertingProviderCallback leaves the conversion of invoke outputs
+// to the framework.
+type selfConvertingProviderCallback struct {
+	fakeProviderCallback
+}
+
+func (p *selfConvertingProviderCallback) OnPostInvoke(_ context.Context, _ *pulumirpc.InvokeRequest, _ interface{}) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func makeKeys(from, to int) string {
+	var keys []string
+	for i := from; i < to; i++ {
+		keys = append(keys, fmt.Sprintf(`{"key":"key%d","expires":"never"}`, i))
+	}
+
+	return "[" + strings.Join(keys, ",") + "]"
+}
+
+func addQueryParams(p pulumirpc.ResourceProviderServer, path string, names ...string) {
+	for _, name := range names {
+		addParams(p, path, http.MethodGet, openapi3.NewQueryParameter(name).WithSchema(openapi3.NewStringSchema()))
+	}
+}
+
+func listKeys(ctx context.Context, t *testing.T, p pulumirpc.ResourceProviderServer, args map[string]any) ([]any, error) {
+	t.Helper()
+
+	args["tailnet"] = "-"
+	props, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(args), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	resp, err := p.Invoke(ctx, &pulumirpc.InvokeRequest{
+		Tok:  listKeysTypeToken,
+		Args: props,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := resp.GetReturn().AsMap()["items"].([]any)
+	require.True(t, ok, "the return value has no items: %v", resp.GetReturn().AsMap())
+
+	return items, nil
+}
+
+func setPagePaginationHint(p pulumirpc.ResourceProviderServer) {
+	p.(*Provider).frameworkMetadata.PaginationMap = map[string]PaginationHint{
+		listKeysTypeToken: {Style: PaginationStylePage, PageParam: "page"},
+	}
+}
+
+func TestListInvokeFollowsLinkHeader(t *testing.T) {
+	ctx := context.Background()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 2 {
+			w.Header().Set(headerLink, fmt.Sprintf(`<%s?page=%d>; rel="next", <%s?page=2>; rel="last"`, r.URL.Path, page+1, r.URL.Path))
+		}
+		_, _ = io.WriteString(w, makeKeys(page*2, page*2+2))
+	}))
+	defer testServer.Close()
+
+	p := makeTestTailscaleProvider(ctx, t, testServer, &selfConvertingProviderCallback{})
+
+	items, err := listKeys(ctx, t, p, map[string]any{})
+	require.NoError(t, err)
+	require.Len(t, items, 6)
+	assert.Equal(t, "key5", items[5].(map[string]any)["key"])
+}
+
+func TestListInvokeDoesNotFollowLinkToAnotherHost(t *testing.T) {
+	ctx := context.Background()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(headerLink, `<https://elsewhere.example.com/keys?page=2>; rel="next"`)
+		_, _ = io.WriteString(w, makeKeys(0, 2))
+	}))
+	defer testServer.Close()
+
+	p := makeTestTailscaleProvider(ctx, t, testServer, &selfConvertingProviderCallback{})
+
+	_, err := listKeys(ctx, t, p, map[string]any{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is not on the API host")
+}
+
+func TestListInvokeFollowsCursorOfPaginationHint(t *testing.T) {
+	ctx := context.Background()
+
+	var requestCount int
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		switch r.URL.Query().Get("page_token") {
+		case "":
+			_, _ = fmt.Fprintf(w, `{"data":{"keys":%s},"meta":{"next":"abc"}}`, makeKeys(0, 2))
+		case "abc":
+			_, _ = fmt.Fprintf(w, `{"data":{"keys":%s},"meta":{"next":null}}`, makeKeys(2, 3))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer testServer.Close()
+
+	p := makeTestTailscaleProvider(ctx, t, testServer, nil)
+	p.(*Provider).frameworkMetadata.PaginationMap = map[string]PaginationHint{
+		listKeysTypeToken: {
+			Style:              PaginationStyleCursor,
+			ItemsProperty:      "data.keys",
+			CursorParam:        "page_token",
+			NextCursorProperty: "meta.next",
+		},
+	}
+
+	args, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(map[string]any{"tailnet": "-"}), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	resp, err := p.Invoke(ctx, &pulumirpc.InvokeRequest{
+		Tok:  listKeysTypeToken,
+		Args: args,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, requestCount)
+
+	data, ok := resp.GetReturn().AsMap()["data"].(map[string]any)
+	require.True(t, ok)
+	assert.Len(t, data["keys"], 3)
+}
+
+func TestListInvokeFollowsOffsetOfPaginationHintAndCapsItems(t *testing.T) {
+	ctx := context.Background()
+
+	var requestCount int
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		_, _ = io.WriteString(w, makeKeys(offset, offset+limit))
+	}))
+	defer testServer.Close()
+
+	p := makeTestTailscaleProvider(ctx, t, testServer, &selfConvertingProviderCallback{})
+	addQueryParams(p, listKeysPath, "offset", "limit")
+
+	// The page size of the hint is sent with every page.
+	p.(*Provider).frameworkMetadata.PaginationMap = map[string]PaginationHint{
+		listKeysTypeToken: {
+			Style:         PaginationStyleOffset,
+			OffsetParam:   "offset",
+			PageSizeParam: "limit",
+			PageSize:      3,
+		},
+	}
+
+	items, err := listKeys(ctx, t, p, map[string]any{"maxItems": 7})
+	require.NoError(t, err)
+	require.Len(t, items, 7)
+	assert.Equal(t, "key6", items[6].(map[string]any)["key"])
+	assert.Equal(t, 3, requestCount)
+}
+
+func TestListInvokeFollowsPageOfPaginationHintAndStopsAtEmptyPage(t *testing.T) {
+	ctx := context.Background()
+
+	var pages []string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		pages = append(pages, page)
+		switch page {
+		case "", "1":
+			_, _ = io.WriteString(w, makeKeys(0, 2))
+		case "2":
+			_, _ = io.WriteString(w, makeKeys(2, 4))
+		default:
+			_, _ = io.WriteString(w, "[]")
+		}
+	}))
+	defer testServer.Close()
+
+	p := makeTestTailscaleProvider(ctx, t, testServer, &selfConvertingProviderCallback{})
+	addQueryParams(p, listKeysPath, "page", "per_page")
+	setPagePaginationHint(p)
+
+	items, err := listKeys(ctx, t, p, map[string]any{})
+	require.NoError(t, err)
+	assert.Len(t, items, 4)
+	assert.Equal(t, []string{"", "2", "3"}, pages)
+}
+
+func TestListInvokeDetectsCursorPaginationFromResponse(t *testing.T) {
+	ctx := context.Background()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			_, _ = fmt.Fprintf(w, `{"keys":%s,"next_cursor":"abc"}`, makeKeys(0, 2))
+		case "abc":
+			_, _ = fmt.Fprintf(w, `{"keys":%s,"next_cursor":null}`, makeKeys(2, 3))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer testServer.Close()
+
+	p := makeTestTailscaleProvider(ctx, t, testServer, nil)
+	addQueryParams(p, listKeysPath, "cursor")
+
+	args, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(map[string]any{"tailnet": "-"}), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	resp, err := p.Invoke(ctx, &pulumirpc.InvokeRequest{
+		Tok:  listKeysTypeToken,
+		Args: args,
+	})
+	require.NoError(t, err)
+	assert.Len(t, resp.GetReturn().AsMap()["keys"], 3)
+}
+
+func TestListInvokeDoesNotGuessPaginationFromQueryParams(t *testing.T) {
+	ctx := context.Background()
+
+	var queries []string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		_, _ = io.WriteString(w, makeKeys(0, 2))
+	}))
+	defer testServer.Close()
+
+	p := makeTestTailscaleProvider(ctx, t, testServer, &selfConvertingProviderCallback{})
+	addQueryParams(p, listKeysPath, "start")
+
+	// The param is a filter of the list, not its offset.
+	items, err := listKeys(ctx, t, p, map[string]any{"start": "2024-01-01"})
+	require.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, []string{"start=2024-01-01"}, queries)
+}
+
+func TestListInvokeStopsAtRepeatedPage(t *testing.T) {
+	ctx := context.Background()
+
+	var requestCount int
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requestCount++
+		// The API ignores the page param.
+		_, _ = io.WriteString(w, makeKeys(0, 2))
+	}))
+	defer testServer.Close()
+
+	p := makeTestTailscaleProvider(ctx, t, testServer, &selfConvertingProviderCallback{})
+	addQueryParams(p, listKeysPath, "page")
+	setPagePaginationHint(p)
+
+	items, err := listKeys(ctx, t, p, map[string]any{})
+	require.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, 2, requestCount)
+}
+
+func TestGetNextLink(t *testing.T) {
+	h := http.Header{}
+	h.Add(headerLink, `<https://api.example.com/items?page=1>; rel="prev first"`)
+	h.Add(headerLink, `<https://api.example.com/items?page=3>; rel=next, <https://api.example.com/items?page=9>; rel="last"`)
+
+	assert.Equal(t, "https://api.example.com/items?page=3", getNextLink(h))
+	assert.Empty(t, getNextLink(http.Header{}))
+
+	// The targets and the quoted params of links can contain commas and
+	// semicolons.
+	h = http.Header{}
+	h.Set(headerLink, `<https://api.example.com/items?ids=1,2;page=1>; title="first, then; next"; rel="prev", `+
+		`<https://api.example.com/items?ids=1,2;page=3>; title="a \"quoted\", title"; rel="next"`)
+	assert.Equal(t, "https://api.example.com/items?ids=1,2;page=3", getNextLink(h))
+}
@@ -0,0 +1,269 @@
+package rest
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/pkg/errors"
+
+	providerGen "github.com/cloudy-sky-software/pulschema/pkg"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/logging"
+)
+
+// requestParams are the query, header and cookie params of a request
+// whose values are taken from the inputs of a resource or invoke.
+type requestParams struct {
+	query   url.Values
+	header  http.Header
+	cookies []*http.Cookie
+
+	// inputNames are the names of the inputs that hold the values of
+	// the params so that they can be removed from the request body.
+	inputNames []string
+}
+
+// getOperationParams returns the params of the operation of an endpoint,
+// including the params shared by all operations of the endpoint.
+func (p *Provider) getOperationParams(apiPath, method string) openapi3.Parameters {
+	pathItem := p.openAPIDoc.Paths.Find(apiPath)
+	if pathItem == nil {
+		return nil
+	}
+
+	params := slices.Clone(pathItem.Parameters)
+	if op := pathItem.GetOperation(method); op != nil {
+		params = append(params, op.Parameters...)
+	}
+
+	return params
+}
+
+// getRequestParams returns the query, header and cookie params of the
+// operation of an endpoint that have a value in inputs, serialized
+// according to their style and explode properties.
+func (p *Provider) getRequestParams(apiPath, method string, inputs resource.PropertyMap) (*requestParams, error) {
+	params := &requestParams{
+		query:  url.Values{},
+		header: http.Header{},
+	}
+
+	for _, paramRef := range p.getOperationParams(apiPath, method) {
+		param := paramRef.Value
+		if param == nil || param.In == openapi3.ParameterInPath || isIgnoredHeaderParam(param) {
+			continue
+		}
+
+		inputName, value, ok := p.getParamInput(param.Name, inputs)
+		if !ok {
+			continue
+		}
+
+		values, err := serializeParam(param, value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "serializing %s param %s", param.In, param.Name)
+		}
+
+		logging.V(3).Infof("Sending input %q as %s param %q", inputName, param.In, param.Name)
+		params.inputNames = append(params.inputNames, inputName)
+
+		switch param.In {
+		case openapi3.ParameterInQuery:
+			for k, v := range values {
+				params.query[k] = append(params.query[k], v...)
+			}
+		case openapi3.ParameterInHeader:
+			params.header.Set(param.Name, values.Get(param.Name))
+		case openapi3.ParameterInCookie:
+			params.cookies = append(params.cookies, &http.Cookie{Name: param.Name, Value: values.Get(param.Name)})
+		}
+	}
+
+	return params, nil
+}
+
+// apply adds the params to httpReq.
+func (r *requestParams) apply(httpReq *http.Request) {
+	if len(r.query) > 0 {
+		query := httpReq.URL.Query()
+		maps.Copy(query, r.query)
+		httpReq.URL.RawQuery = query.Encode()
+	}
+
+	for k, v := range r.header {
+		httpReq.Header[k] = v
+	}
+
+	for _, cookie := range r.cookies {
+		httpReq.AddCookie(cookie)
+	}
+}
+
+// removeFromRequestBody deletes the inputs that were sent as params from
+// the request body.
+func (r *requestParams) removeFromRequestBody(bodyMap map[string]interface{}) {
+	for _, name := range r.inputNames {
+		delete(bodyMap, name)
+	}
+}
+
+// isIgnoredHeaderParam returns true for the header params that the
+// OpenAPI spec says must be ignored since they are set by the framework.
+func isIgnoredHeaderParam(param *openapi3.Parameter) bool {
+	if param.In != openapi3.ParameterInHeader {
+		return false
+	}
+
+	switch http.CanonicalHeaderKey(param.Name) {
+	case "Accept", "Content-Type", "Authorization":
+		return true
+	default:
+		return false
+	}
+}
+
+// getParamInput returns the input that holds the value of a param, which
+// is named either like the param or like its SDK name.
+func (p *Provider) getParamInput(paramName string, inputs resource.PropertyMap) (string, resource.PropertyValue, bool) {
+	for _, name := range []string{paramName, getOrKey(p.metadata.APIToSDKNameMap, paramName), providerGen.ToSdkName(paramName)} {
+		value, ok := inputs[resource.PropertyKey(name)]
+		if !ok {
+			continue
+		}
+
+		value, known := unwrapPropertyValue(value)
+		if !known || value.IsNull() {
+			return "", resource.PropertyValue{}, false
+		}
+
+		return name, value, true
+	}
+
+	return "", resource.PropertyValue{}, false
+}
+
+// serializeParam serializes the value of a param as the query values or,
+// for header and cookie params, the single value keyed by the param name.
+func serializeParam(param *openapi3.Parameter, value resource.PropertyValue) (url.Values, error) {
+	values := url.Values{}
+
+	// A param with content is serialized with its media type, which is
+	// expected to be JSON.
+	if len(param.Content) > 0 {
+		b, err := json.Marshal(toParamValue(value))
+		if err != nil {
+			return nil, err
+		}
+
+		values.Set(param.Name, string(b))
+		return values, nil
+	}
+
+	sm, err := param.SerializationMethod()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case value.IsArray():
+		var items []string
+		for _, item := range value.ArrayValue() {
+			items = append(items, formatParamValue(toParamValue(item)))
+		}
+
+		if param.In == openapi3.ParameterInQuery && sm.Style == openapi3.SerializationForm && sm.Explode {
+			values[param.Name] = items
+		} else {
+			values.Set(param.Name, strings.Join(items, getParamDelimiter(sm.Style)))
+		}
+	case value.IsObject():
+		obj := value.ObjectValue()
+		keys := slices.Sorted(maps.Keys(obj))
+
+		switch {
+		case param.In == openapi3.ParameterInQuery && sm.Style == openapi3.SerializationDeepObject:
+			for _, k := range keys {
+				values.Set(param.Name+"["+string(k)+"]", formatParamValue(toParamValue(obj[k])))
+			}
+		case param.In == openapi3.ParameterInQuery && sm.Style == openapi3.SerializationForm && sm.Explode:
+			for _, k := range keys {
+				values.Set(string(k), formatParamValue(toParamValue(obj[k])))
+			}
+		default:
+			var pairs []string
+			for _, k := range keys {
+				v := formatParamValue(toParamValue(obj[k]))
+				if param.In == openapi3.ParameterInHeader && sm.Explode {
+					pairs = append(pairs, string(k)+"="+v)
+				} else {
+					pairs = append(pairs, string(k), v)
+				}
+			}
+			values.Set(param.Name, strings.Join(pairs, getParamDelimiter(sm.Style)))
+		}
+	default:
+		values.Set(param.Name, formatParamValue(toParamValue(value)))
+	}
+
+	return values, nil
+}
+
+func getParamDelimiter(style string) string {
+	switch style {
+	case openapi3.SerializationSpaceDelimited:
+		return " "
+	case openapi3.SerializationPipeDelimited:
+		return "|"
+	default:
+		return ","
+	}
+}
+
+// toParamValue returns the plain value of a property value with its
+// secrets unwrapped.
+func toParamValue(value resource.PropertyValue) interface{} {
+	value, known := unwrapPropertyValue(value)
+	if !known {
+		return nil
+	}
+
+	switch {
+	case value.IsArray():
+		items := make([]interface{}, 0, len(value.ArrayValue()))
+		for _, item := range value.ArrayValue() {
+			items = append(items, toParamValue(item))
+		}
+		return items
+	case value.IsObject():
+		obj := make(map[string]interface{}, len(value.ObjectValue()))
+		for k, v := range value.ObjectValue() {
+			obj[string(k)] = toParamValue(v)
+		}
+		return obj
+	default:
+		return value.V
+	}
+}
+
+func formatParamValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
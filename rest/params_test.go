@@ -0,0 +1,150 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+)
+
+func addParams(p pulumirpc.ResourceProviderServer, path, method string, params ...*openapi3.Parameter) {
+	op := p.(*Provider).openAPIDoc.Paths.Find(path).GetOperation(method)
+	for _, param := range params {
+		op.Parameters = append(op.Parameters, &openapi3.ParameterRef{Value: param})
+	}
+}
+
+func TestInputsAreSentAsQueryHeaderAndCookieParams(t *testing.T) {
+	ctx := context.Background()
+
+	p := makeTestGenericProvider(ctx, t, nil, nil)
+	addParams(p, "/v2/fakeresource", http.MethodPost,
+		openapi3.NewQueryParameter("dry_run").WithSchema(openapi3.NewBoolSchema()),
+		openapi3.NewHeaderParameter("X-Api-Version").WithSchema(openapi3.NewStringSchema()),
+		openapi3.NewCookieParameter("session").WithSchema(openapi3.NewStringSchema()),
+		openapi3.NewQueryParameter("unset").WithSchema(openapi3.NewStringSchema()),
+	)
+
+	inputs := map[string]any{
+		"simpleProp":   "somevalue",
+		"dryRun":       true,
+		"XApiVersion":  "2024-01-01",
+		"session":      "abc",
+		"anotherInput": "another value",
+	}
+	body, err := json.Marshal(inputs)
+	require.NoError(t, err)
+
+	httpReq, err := p.(Request).CreatePostRequest(ctx, "/v2/fakeresource", body, resource.NewPropertyMapFromMap(inputs))
+	require.NoError(t, err)
+
+	assert.Equal(t, "dry_run=true", httpReq.URL.RawQuery)
+	assert.Equal(t, "2024-01-01", httpReq.Header.Get("X-Api-Version"))
+	cookie, err := httpReq.Cookie("session")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", cookie.Value)
+
+	reqBody, err := io.ReadAll(httpReq.Body)
+	require.NoError(t, err)
+	var bodyMap map[string]any
+	require.NoError(t, json.Unmarshal(reqBody, &bodyMap))
+	assert.NotContains(t, bodyMap, "dryRun")
+	assert.NotContains(t, bodyMap, "XApiVersion")
+	assert.NotContains(t, bodyMap, "session")
+	assert.Contains(t, bodyMap, "simple_prop")
+}
+
+func TestGetRequestQueryParamsHonorStyleAndExplode(t *testing.T) {
+	ctx := context.Background()
+
+	noExplode := false
+	p := makeTestGenericProvider(ctx, t, nil, nil)
+	addParams(p, "/v2/fakeresource/{resourceId}", http.MethodGet,
+		openapi3.NewQueryParameter("tags").WithSchema(openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema())),
+		&openapi3.Parameter{
+			Name:    "fields",
+			In:      openapi3.ParameterInQuery,
+			Explode: &noExplode,
+			Schema:  openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema()).NewRef(),
+		},
+		&openapi3.Parameter{
+			Name:   "filter",
+			In:     openapi3.ParameterInQuery,
+			Style:  openapi3.SerializationDeepObject,
+			Schema: openapi3.NewObjectSchema().WithAdditionalProperties(openapi3.NewStringSchema()).NewRef(),
+		},
+	)
+
+	httpReq, err := p.(Request).CreateGetRequest(ctx, "/v2/fakeresource/{resourceId}", resource.NewPropertyMapFromMap(map[string]any{
+		"resourceId": "12345",
+		"tags":       []any{"a", "b"},
+		"fields":     []any{"id", "name"},
+		"filter":     map[string]any{"type": "x"},
+	}), nil)
+	require.NoError(t, err)
+
+	query := httpReq.URL.Query()
+	assert.Equal(t, []string{"a", "b"}, query["tags"])
+	assert.Equal(t, "id,name", query.Get("fields"))
+	assert.Equal(t, "x", query.Get("filter[type]"))
+	assert.Equal(t, "/v2/fakeresource/12345", httpReq.URL.Path)
+}
+
+func TestSerializeParam(t *testing.T) {
+	explode := true
+	noExplode := false
+
+	tests := []struct {
+		name     string
+		param    *openapi3.Parameter
+		value    any
+		expected map[string][]string
+	}{
+		{
+			name:     "pipe delimited array",
+			param:    &openapi3.Parameter{Name: "ids", In: openapi3.ParameterInQuery, Style: openapi3.SerializationPipeDelimited, Explode: &noExplode},
+			value:    []any{1, 2},
+			expected: map[string][]string{"ids": {"1|2"}},
+		},
+		{
+			name:     "exploded form object",
+			param:    &openapi3.Parameter{Name: "color", In: openapi3.ParameterInQuery},
+			value:    map[string]any{"R": 100, "G": 200},
+			expected: map[string][]string{"R": {"100"}, "G": {"200"}},
+		},
+		{
+			name:     "header object",
+			param:    &openapi3.Parameter{Name: "X-Color", In: openapi3.ParameterInHeader},
+			value:    map[string]any{"R": 100, "G": 200},
+			expected: map[string][]string{"X-Color": {"G,200,R,100"}},
+		},
+		{
+			name:     "exploded header object",
+			param:    &openapi3.Parameter{Name: "X-Color", In: openapi3.ParameterInHeader, Explode: &explode},
+			value:    map[string]any{"R": 100, "G": 200},
+			expected: map[string][]string{"X-Color": {"G=200,R=100"}},
+		},
+		{
+			name:     "json content",
+			param:    &openapi3.Parameter{Name: "q", In: openapi3.ParameterInQuery, Content: openapi3.NewContentWithJSONSchema(openapi3.NewObjectSchema())},
+			value:    map[string]any{"a": "b"},
+			expected: map[string][]string{"q": {`{"a":"b"}`}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := serializeParam(tt.param, resource.NewPropertyValue(tt.value))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, map[string][]string(values))
+		})
+	}
+}
@@ -5,12 +5,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
@@ -24,6 +27,7 @@ import (
 	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
 	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
 	"github.com/pulumi/pulumi/sdk/v3/go/common/util/logging"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/rpcutil/rpcerror"
 	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
 
 	"github.com/cloudy-sky-software/pulumi-provider-framework/callback"
@@ -45,34 +49,117 @@ import (
 type Provider struct {
 	pulumirpc.UnimplementedResourceProviderServer
 
-	host    *provider.HostClient
+	host    atomic.Pointer[provider.HostClient]
 	name    string
 	version string
 
-	metadata providerGen.ProviderMetadata
-	router   routers.Router
+	metadata          providerGen.ProviderMetadata
+	frameworkMetadata FrameworkMetadata
+	// customRouter is true if the router was set with WithRouter
+	// and should not be re-created when the provider is configured.
+	customRouter bool
+	// customBaseURL is true if the base URL was set with WithBaseURL
+	// and the server should not be selected by the provider config.
+	customBaseURL bool
 
 	providerCallback callback.ProviderCallback
 
-	baseURL    string
-	httpClient *http.Client
-	openAPIDoc openapi3.T
-	schema     pschema.PackageSpec
+	httpClient         *http.Client
+	retryTransport     *retryTransport
+	rateLimitTransport *rateLimitTransport
+	openAPIDoc         openapi3.T
+	schema             pschema.PackageSpec
+
+	// authenticator is the authenticator set with WithAuthenticator.
+	authenticator Authenticator
+
+	// idempotencyKeyHeader is the header in which the idempotency key of
+	// create requests is sent. Idempotency keys are disabled if empty.
+	idempotencyKeyHeader string
+
+	concurrencyHint    *ConcurrencyHint
+	concurrencyLimiter *concurrencyLimiter
+
+	// configMu serializes calls to Configure. The configured state
+	// itself is replaced atomically so that it can be read by concurrent
+	// RPCs without locking.
+	configMu sync.Mutex
+	cfg      atomic.Pointer[providerConfig]
+
+	asyncPollInterval    time.Duration
+	asyncMaxPollInterval time.Duration
+
+	// cancelCtx is done when the engine cancels the provider. Every
+	// operation of the provider derives its context from it.
+	cancelCtx context.Context
+	cancel    context.CancelFunc
+}
+
+// providerConfig is the state of a provider that is set when it is
+// configured. It is never modified after it is stored in the provider.
+type providerConfig struct {
+	baseURL string
+	// servers are the servers of the OpenAPI doc with their variables
+	// resolved, starting with the server of the base URL.
+	servers openapi3.Servers
+	// operationServerURLs are the URLs of the servers of the operations
+	// whose path or operation overrides the servers of the OpenAPI doc,
+	// keyed by method and path.
+	operationServerURLs map[string]string
+	router              routers.Router
 
 	// Global path params for this provider - for path params that are fixed
 	// for a provider. Can be configured during the OnConfigure callback func
 	globalPathParams map[string]string
 
+	// oauth2Authenticator authenticates requests if the provider config
+	// has OAuth2 client credentials.
+	oauth2Authenticator *OAuth2Authenticator
+
+	// retryPolicy and rateLimitRules are the settings of the transports
+	// of the HTTP client from the provider config. They are applied to
+	// the transports when the config is stored. rateLimitRules is nil if
+	// the provider config doesn't set them.
+	retryPolicy    *RetryPolicy
+	rateLimitRules []RateLimitRule
+
 	engineSendsOldInputs         bool
 	engineSendsOldInputsOnDelete bool
 }
 
+// config returns the current configured state of the provider.
+func (p *Provider) config() *providerConfig {
+	return p.cfg.Load()
+}
+
 func defaultTransportDialContext(dialer *net.Dialer) func(context.Context, string, string) (net.Conn, error) {
 	return dialer.DialContext
 }
 
+// defaultTransport returns the transport used to send requests to the
+// API unless the provider is given an HTTP client. It is mostly a copy
+// of the http.DefaultTransport with the exception of ForceAttemptHTTP2
+// set to false.
+func defaultTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: defaultTransportDialContext(&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}),
+		ForceAttemptHTTP2:     false,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
 // MakeProvider returns an instance of the REST-based resource provider handler.
-func MakeProvider(host *provider.HostClient, name, version string, pulumiSchemaBytes, openapiDocBytes, metadataBytes []byte, callback callback.ProviderCallback) (pulumirpc.ResourceProviderServer, error) {
+//
+// The provider can be customized with options such as WithHTTPClient or
+// WithRetryPolicy.
+func MakeProvider(host *provider.HostClient, name, version string, pulumiSchemaBytes, openapiDocBytes, metadataBytes []byte, callback callback.ProviderCallback, opts ...Option) (pulumirpc.ResourceProviderServer, error) {
 	openapiDoc := openapi.GetOpenAPISpec(openapiDocBytes)
 
 	var metadata providerGen.ProviderMetadata
@@ -80,27 +167,23 @@ func MakeProvider(host *provider.HostClient, name, version string, pulumiSchemaB
 		return nil, errors.Wrap(err, "unmarshaling the metadata bytes to json")
 	}
 
-	httpClient := &http.Client{
-		// The transport is mostly a copy of the http.DefaultTransport
-		// with the exception of ForceAttemptHTTP2 set to false.
-		// It is wrapped with rateLimitTransport to handle HTTP 429 responses.
-		Transport: &rateLimitTransport{
-			wrapped: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-				DialContext: defaultTransportDialContext(&net.Dialer{
-					Timeout:   30 * time.Second,
-					KeepAlive: 30 * time.Second,
-				}),
-				ForceAttemptHTTP2:     false,
-				MaxIdleConns:          100,
-				IdleConnTimeout:       90 * time.Second,
-				TLSHandshakeTimeout:   10 * time.Second,
-				ExpectContinueTimeout: 1 * time.Second,
-			},
-		},
-		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
-			return errors.New("unable to handle redirects")
-		},
+	var frameworkMetadata FrameworkMetadata
+	if err := json.Unmarshal(metadataBytes, &frameworkMetadata); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling the framework metadata")
+	}
+
+	var options providerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	httpClient, transports := newHTTPClient(options)
+
+	if options.baseURL != "" {
+		if len(openapiDoc.Servers) == 0 {
+			openapiDoc.Servers = openapi3.Servers{{}}
+		}
+		openapiDoc.Servers[0].URL = options.baseURL
 	}
 
 	var pulumiSchema pschema.PackageSpec
@@ -108,20 +191,114 @@ func MakeProvider(host *provider.HostClient, name, version string, pulumiSchemaB
 		return nil, errors.Wrap(err, "unmarshaling pulumi schema into its package spec form")
 	}
 
-	// Return the new provider
-	return &Provider{
-		host:       host,
+	cancelCtx, cancel := context.WithCancel(context.Background())
+
+	p := &Provider{
 		name:       name,
 		version:    version,
 		schema:     pulumiSchema,
-		baseURL:    openapiDoc.Servers[0].URL,
 		openAPIDoc: *openapiDoc,
 		metadata:   metadata,
 		httpClient: httpClient,
 
+		retryTransport: transports.retry,
+
+		rateLimitTransport: transports.rateLimit,
+
+		authenticator: options.authenticator,
+
+		idempotencyKeyHeader: options.idempotencyKeyHeader,
+
+		concurrencyHint:    options.concurrencyHint,
+		concurrencyLimiter: newConcurrencyLimiter(),
+
+		customRouter:  options.router != nil,
+		customBaseURL: options.baseURL != "",
+
+		frameworkMetadata: frameworkMetadata,
+
 		providerCallback: callback,
+
+		asyncPollInterval:    defaultAsyncPollInterval,
+		asyncMaxPollInterval: defaultAsyncMaxPollInterval,
+
+		cancelCtx: cancelCtx,
+		cancel:    cancel,
+	}
+	p.host.Store(host)
+	cfg := &providerConfig{
+		router:           options.router,
 		globalPathParams: make(map[string]string),
-	}, nil
+	}
+	if err := p.configureServers(nil, cfg); err != nil {
+		return nil, errors.Wrap(err, "configuring servers")
+	}
+	p.cfg.Store(cfg)
+
+	// Token requests of an OAuth2 authenticator set with WithAuthenticator
+	// are sent with the provider's HTTP client like those of the one in
+	// the provider config.
+	if a, ok := options.authenticator.(*OAuth2Authenticator); ok && a.source.httpClient == nil {
+		a.source.httpClient = httpClient
+	}
+	transports.oauth2.getAuthenticator = p.getAuthenticator
+	transports.signing.getAuthenticator = p.getAuthenticator
+
+	// Return the new provider
+	return p, nil
+}
+
+// getOutputState returns the state to store for the outputs of a
+// resource. Unless the engine sends the old inputs, a copy of the
+// inputs is stashed in the state.
+func (p *Provider) getOutputState(outputsMap map[string]interface{}, inputs resource.PropertyMap) resource.PropertyMap {
+	if !p.config().engineSendsOldInputs {
+		return state.GetResourceState(outputsMap, inputs)
+	}
+
+	return resource.NewPropertyMapFromMap(outputsMap)
+}
+
+// newResourceInitError returns the error for a resource that the API
+// accepted but that could not be created or updated completely, e.g.
+// because its async operation failed or it did not become ready in
+// time. The error has the ID of the resource and its known state, which
+// are currentState updated with outputs, so that the engine keeps it in
+// the stack's state from where it can be refreshed or deleted. err is
+// returned as-is if the ID of the resource is not known.
+func (p *Provider) newResourceInitError(ctx context.Context, resourceTypeToken string, crudMap *providerGen.CRUDOperationsMap, id string, outputs interface{}, inputs resource.PropertyMap, currentState resource.PropertyMap, inputProperties *structpb.Struct, err error) error {
+	outputsMap, ok := outputs.(map[string]interface{})
+	if !ok {
+		return err
+	}
+
+	p.TransformBody(ctx, outputsMap, p.metadata.APIToSDKNameMap)
+
+	if id == "" {
+		v, ok := getResourceID(outputsMap)
+		if !ok {
+			return err
+		}
+		id = convertNumericIDToString(v)
+	}
+
+	outputState := currentState.Copy()
+	maps.Copy(outputState, p.getOutputState(outputsMap, inputs))
+	p.preserveWriteOnlyProperties(crudMap, inputs, outputState)
+	p.markSchemaSecrets(resourceTypeToken, outputState, nil)
+
+	outputProperties, marshalErr := plugin.MarshalProperties(outputState, state.DefaultMarshalOpts)
+	if marshalErr != nil {
+		logging.V(3).Infof("Could not marshal the state of resource %s: %v", id, marshalErr)
+		return err
+	}
+
+	return rpcerror.WithDetails(rpcerror.New(codes.Unknown, err.Error()), &pulumirpc.ErrorResourceInitFailed{
+		Id:         id,
+		Properties: outputProperties,
+		Inputs:     inputProperties,
+		Reasons:    []string{err.Error()},
+	})
 }
 
 // GetResourceTypeToken returns the type token from a resource URN string.
@@ -140,7 +317,7 @@ func (p *Provider) Attach(_ context.Context, req *pulumirpc.PluginAttach) (*pbem
 	if err != nil {
 		return nil, err
 	}
-	p.host = host
+	p.host.Store(host)
 	return &pbempty.Empty{}, nil
 }
 
@@ -165,11 +342,26 @@ func (p *Provider) DiffConfig(_ context.Context, _ *pulumirpc.DiffRequest) (*pul
 }
 
 // Configure configures the resource provider with "globals" that control its behavior.
+//
+// The configured state is replaced as a whole once Configure succeeds so
+// that concurrent operations never observe a partially configured provider.
 func (p *Provider) Configure(ctx context.Context, req *pulumirpc.ConfigureRequest) (*pulumirpc.ConfigureResponse, error) {
-	p.engineSendsOldInputs = req.SendsOldInputs
-	p.engineSendsOldInputsOnDelete = req.SendsOldInputsToDelete
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
+
+	current := p.config()
+	cfg := &providerConfig{
+		router:                       current.router,
+		globalPathParams:             current.globalPathParams,
+		engineSendsOldInputs:         req.SendsOldInputs,
+		engineSendsOldInputsOnDelete: req.SendsOldInputsToDelete,
+	}
+
+	logging.V(3).Infof("Engine configuration: engineSendsOldInputs: %t, engineSendsOldInputsOnDelete: %t", cfg.engineSendsOldInputs, cfg.engineSendsOldInputsOnDelete)
 
-	logging.V(3).Infof("Engine configuration: engineSendsOldInputs: %t, engineSendsOldInputsOnDelete: %t", p.engineSendsOldInputs, p.engineSendsOldInputsOnDelete)
+	if err := p.configureServers(req.GetVariables(), cfg); err != nil {
+		return nil, errors.Wrap(err, "configuring servers")
+	}
 
 	// Override the API host, if required. Intended for providers where the server names in the
 	// openapi spec will not match the API host that the provider needs to interact with during a deployment.
@@ -187,25 +379,41 @@ func (p *Provider) Configure(ctx context.Context, req *pulumirpc.ConfigureReques
 
 	if apiHost != "" {
 		logging.V(3).Infof("ApiHost overridden to %s", apiHost)
-		baseURL, err := url.Parse(p.baseURL)
+		baseURL, err := url.Parse(cfg.baseURL)
 		if err != nil {
 			return nil, err
 		}
 		baseURL.Host = apiHost
-		p.baseURL = baseURL.String()
+		cfg.baseURL = baseURL.String()
 
-		// apply new base URL value to the openAPIDoc of the provider, so the router (created below) will use it
-		p.openAPIDoc.Servers[0].URL = p.baseURL
+		// apply new base URL value to the servers of the provider, so the router (created below) will use it
+		server := *cfg.servers[0]
+		server.URL = cfg.baseURL
+		cfg.servers = append(openapi3.Servers{&server}, cfg.servers[1:]...)
 
-		logging.V(3).Infof("Full API URL now %s", p.baseURL)
+		logging.V(3).Infof("Full API URL now %s", cfg.baseURL)
+	}
+
+	if err := p.configureRetryPolicy(req.GetVariables(), cfg); err != nil {
+		return nil, err
+	}
+
+	if err := p.configureRateLimits(req.GetVariables(), cfg); err != nil {
+		return nil, err
+	}
+
+	if err := p.configureOAuth2(req.GetVariables(), cfg); err != nil {
+		return nil, err
 	}
 
 	// the router creation is deferred to allow for api host name modifications through configuration
-	router, err := gorillamux.NewRouter(&p.openAPIDoc)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating api router mux")
+	if !p.customRouter {
+		router, err := gorillamux.NewRouter(p.getRouterDoc(cfg))
+		if err != nil {
+			return nil, errors.Wrap(err, "creating api router mux")
+		}
+		cfg.router = router
 	}
-	p.router = router
 
 	callbackResp, err := p.providerCallback.OnConfigure(ctx, req)
 	if err != nil {
@@ -216,9 +424,19 @@ func (p *Provider) Configure(ctx context.Context, req *pulumirpc.ConfigureReques
 	if err != nil {
 		return nil, errors.Wrap(err, "getting global path params")
 	} else if globalPathParams != nil {
-		p.globalPathParams = globalPathParams
+		cfg.globalPathParams = maps.Clone(globalPathParams)
 	}
 
+	// The transports are shared by all operations, so they are only
+	// changed once nothing else can fail.
+	if cfg.retryPolicy != nil {
+		p.retryTransport.setPolicy(*cfg.retryPolicy)
+	}
+	if cfg.rateLimitRules != nil {
+		p.rateLimitTransport.setRules(cfg.rateLimitRules)
+	}
+	p.cfg.Store(cfg)
+
 	if callbackResp != nil {
 		return callbackResp, nil
 	}
@@ -232,7 +450,7 @@ func (p *Provider) convertInvokeOutput(_ context.Context, req *pulumirpc.InvokeR
 	invokeTypeToken := req.GetTok()
 
 	// Return non-list operations as-is.
-	if !strings.Contains(invokeTypeToken, ":list") {
+	if !isListInvoke(invokeTypeToken) {
 		return outputs.(map[string]interface{}), nil
 	}
 
@@ -257,7 +475,13 @@ func (p *Provider) convertInvokeOutput(_ context.Context, req *pulumirpc.InvokeR
 }
 
 // Invoke dynamically executes a built-in function in the provider.
-func (p *Provider) Invoke(ctx context.Context, req *pulumirpc.InvokeRequest) (*pulumirpc.InvokeResponse, error) {
+func (p *Provider) Invoke(ctx context.Context, req *pulumirpc.InvokeRequest) (_ *pulumirpc.InvokeResponse, err error) {
+	ctx, cancel := p.withCancellation(ctx)
+	defer cancel()
+	defer func() {
+		err = p.canceledError(err)
+	}()
+
 	args, err := plugin.UnmarshalProperties(req.Args, state.DefaultUnmarshalOpts)
 	if err != nil {
 		return nil, errors.Wrap(err, "unmarshal input properties as propertymap")
@@ -274,11 +498,24 @@ func (p *Provider) Invoke(ctx context.Context, req *pulumirpc.InvokeRequest) (*p
 
 	httpEndpointPath := *crudMap.R
 
+	isList := isListInvoke(invokeTypeToken)
+	var maxItems int
+	if isList {
+		maxItems, err = popMaxItems(args)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	httpReq, err := p.CreateGetRequest(ctx, httpEndpointPath, args, nil)
 	if err != nil {
 		return nil, errors.Wrapf(err, "creating get request (type token: %s)", invokeTypeToken)
 	}
 
+	if isList {
+		p.setPageSize(invokeTypeToken, httpReq)
+	}
+
 	if err := p.providerCallback.OnPreInvoke(ctx, req, httpReq); err != nil {
 		return nil, err
 	}
@@ -296,7 +533,7 @@ func (p *Provider) Invoke(ctx context.Context, req *pulumirpc.InvokeRequest) (*p
 		}
 
 		httpResp.Body.Close()
-		return nil, errors.Errorf("http request failed (status: %s): %s", httpResp.Status, string(body))
+		return nil, p.newAPIError(httpReq, httpResp, body)
 	}
 
 	body, err := io.ReadAll(httpResp.Body)
@@ -311,6 +548,13 @@ func (p *Provider) Invoke(ctx context.Context, req *pulumirpc.InvokeRequest) (*p
 		return nil, errors.Wrap(err, "unmarshaling the response")
 	}
 
+	if isList {
+		outputs, err = p.fetchRemainingPages(ctx, invokeTypeToken, httpEndpointPath, httpReq, httpResp, outputs, maxItems)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetching the pages of %s", invokeTypeToken)
+		}
+	}
+
 	logging.V(3).Infof("RESPONSE BODY: %v", outputs)
 
 	outputsMap, postInvokeErr := p.providerCallback.OnPostInvoke(ctx, req, outputs)
@@ -349,15 +593,6 @@ func (p *Provider) Check(_ context.Context, req *pulumirpc.CheckRequest) (*pulum
 	urn := req.GetUrn()
 	resourceName := getResourceName(urn)
 	resourceTypeToken := GetResourceTypeToken(urn)
-	autoNameProp, ok := p.metadata.AutoNameMap[resourceTypeToken]
-
-	// If this resource type token is not in the auto-name map,
-	// then return the default `CheckResponse`.
-	if !ok {
-		return &pulumirpc.CheckResponse{Inputs: req.GetNews(), Failures: nil}, nil
-	}
-
-	logging.V(3).Infof("Resource type %q has an auto-name property %q", resourceTypeToken, autoNameProp)
 
 	inputs, err := plugin.UnmarshalProperties(req.GetNews(), state.DefaultUnmarshalOpts)
 	if err != nil {
@@ -369,31 +604,50 @@ func (p *Provider) Check(_ context.Context, req *pulumirpc.CheckRequest) (*pulum
 		return nil, errors.Wrap(err, "unmarshaling old inputs in check method")
 	}
 
-	namePropKey := resource.PropertyKey(autoNameProp)
+	if autoNameProp, ok := p.metadata.AutoNameMap[resourceTypeToken]; ok {
+		logging.V(3).Infof("Resource type %q has an auto-name property %q", resourceTypeToken, autoNameProp)
 
-	// If neither the new inputs nor the old inputs have the name property
-	if _, ok := inputs[namePropKey]; !ok {
-		logging.V(3).Infof("New inputs did not have auto-name property %q", autoNameProp)
+		namePropKey := resource.PropertyKey(autoNameProp)
 
-		if oldAutoNameValue, ok := olds[namePropKey]; !ok {
-			logging.V(3).Infof("Old inputs did not have auto-name property %q. Will generate a new value...", autoNameProp)
+		// If neither the new inputs nor the old inputs have the name property
+		if _, ok := inputs[namePropKey]; !ok {
+			logging.V(3).Infof("New inputs did not have auto-name property %q", autoNameProp)
 
-			randomName, err := resource.NewUniqueName(req.GetRandomSeed(), resourceName+"-", 8, 24, nil)
-			if err != nil {
-				return nil, errors.Wrapf(err, "creating unique name for %s (token: %s)", resourceName, resourceTypeToken)
+			if oldAutoNameValue, ok := olds[namePropKey]; !ok {
+				logging.V(3).Infof("Old inputs did not have auto-name property %q. Will generate a new value...", autoNameProp)
+
+				randomName, err := resource.NewUniqueName(req.GetRandomSeed(), resourceName+"-", 8, 24, nil)
+				if err != nil {
+					return nil, errors.Wrapf(err, "creating unique name for %s (token: %s)", resourceName, resourceTypeToken)
+				}
+				inputs[namePropKey] = resource.NewStringProperty(randomName)
+			} else {
+				logging.V(3).Infof("Found auto-name property %q in old inputs. Will set that in new inputs...", autoNameProp)
+				inputs[namePropKey] = oldAutoNameValue
 			}
-			inputs[namePropKey] = resource.NewStringProperty(randomName)
-		} else {
-			logging.V(3).Infof("Found auto-name property %q in old inputs. Will set that in new inputs...", autoNameProp)
-			inputs[namePropKey] = oldAutoNameValue
 		}
 	}
 
-	updatedInputs, err := plugin.MarshalProperties(inputs, state.DefaultMarshalOpts)
+	var failures []*pulumirpc.CheckFailure
+	if crudMap, ok := p.metadata.ResourceCRUDMap[resourceTypeToken]; ok {
+		// Set the default values of omitted properties before validating
+		// the inputs so that the inputs stored in the state match the
+		// request that is sent to the API.
+		p.applyDefaults(crudMap, inputs)
+		failures = p.validateInputs(crudMap, inputs)
+		if len(failures) > 0 {
+			logging.V(3).Infof("Inputs of %s failed validation: %v", urn, failures)
+		}
+	}
+
+	p.setIdempotencyKey(inputs, urn, req.GetRandomSeed())
+
+	checkedInputs, err := plugin.MarshalProperties(inputs, state.DefaultMarshalOpts)
 	if err != nil {
 		return nil, errors.Wrap(err, "marshaling updated inputs in check method")
 	}
-	return &pulumirpc.CheckResponse{Inputs: updatedInputs}, nil
+
+	return &pulumirpc.CheckResponse{Inputs: checkedInputs, Failures: failures}, nil
 }
 
 // Diff checks what impacts a hypothetical update will have on the resource's properties.
@@ -414,6 +668,16 @@ func (p *Provider) Diff(ctx context.Context, req *pulumirpc.DiffRequest) (*pulum
 		return nil, err
 	}
 
+	// A new version of the resource is not a change of its inputs,
+	// and neither is a new idempotency key.
+	p.excludeVersionProperty(resourceTypeToken, olds, news)
+	popIdempotencyKey(olds)
+	popIdempotencyKey(news)
+
+	// The old inputs may have been stored before Check set the default
+	// values of omitted properties, which is not a change either.
+	p.applyDefaults(crudMap, olds)
+
 	logging.V(3).Infof("Calculating diff: olds: %v; news: %v", olds, news)
 	diff := olds.Diff(news)
 	if diff == nil || !diff.AnyChanges() {
@@ -441,20 +705,17 @@ func (p *Provider) Diff(ctx context.Context, req *pulumirpc.DiffRequest) (*pulum
 		// then we'll need to trigger a replacement.
 		logging.V(3).Infof("Resource type %s will only support replacement as it does not have update endpoints", resourceTypeToken)
 
-		changedKeys := diff.ChangedKeys()
-		replaces := make([]string, 0, len(changedKeys))
-
 		// Capture all keys that have changed.
-		for _, prop := range changedKeys {
-			replaces = append(replaces, string(prop))
-		}
+		replaces, diffs, detailedDiff := p.determineDiffsAndReplacements(diff, nil)
 
 		logging.V(3).Infof("Diffs for properties: %v", replaces)
 
 		return &pulumirpc.DiffResponse{
-			Changes:  pulumirpc.DiffResponse_DIFF_SOME,
-			Replaces: replaces,
-			Diffs:    replaces,
+			Changes:         pulumirpc.DiffResponse_DIFF_SOME,
+			Replaces:        replaces,
+			Diffs:           diffs,
+			DetailedDiff:    detailedDiff,
+			HasDetailedDiff: true,
 		}, nil
 	}
 
@@ -500,6 +761,7 @@ func (p *Provider) Diff(ctx context.Context, req *pulumirpc.DiffRequest) (*pulum
 
 	var replaces []string
 	var diffs []string
+	var detailedDiff map[string]*pulumirpc.PropertyDiff
 	changes := pulumirpc.DiffResponse_DIFF_SOME
 	patchReqSchema := updateOp.RequestBody.Value.Content[jsonMimeType]
 
@@ -509,7 +771,7 @@ func (p *Provider) Diff(ctx context.Context, req *pulumirpc.DiffRequest) (*pulum
 	}
 
 	if len(patchReqSchema.Schema.Value.Properties) != 0 {
-		replaces, diffs = p.determineDiffsAndReplacements(diff, *patchReqSchema.Schema)
+		replaces, diffs, detailedDiff = p.determineDiffsAndReplacements(diff, patchReqSchema.Schema.Value)
 	} else {
 		changes = pulumirpc.DiffResponse_DIFF_UNKNOWN
 	}
@@ -517,21 +779,31 @@ func (p *Provider) Diff(ctx context.Context, req *pulumirpc.DiffRequest) (*pulum
 	logging.V(3).Infof("Diff response: replaces: %v; diffs: %v", replaces, diffs)
 
 	return &pulumirpc.DiffResponse{
-		Changes:  changes,
-		Replaces: replaces,
-		Diffs:    diffs,
+		Changes:         changes,
+		Replaces:        replaces,
+		Diffs:           diffs,
+		DetailedDiff:    detailedDiff,
+		HasDetailedDiff: detailedDiff != nil,
 	}, nil
 }
 
 // Create allocates a new instance of the provided resource and returns its unique ID afterwards.
-func (p *Provider) Create(ctx context.Context, req *pulumirpc.CreateRequest) (*pulumirpc.CreateResponse, error) {
+func (p *Provider) Create(ctx context.Context, req *pulumirpc.CreateRequest) (_ *pulumirpc.CreateResponse, err error) {
 	logging.V(3).Infof("Create: %s", req.GetUrn())
 
+	ctx, cancel := p.withOperationTimeout(ctx, req.GetTimeout())
+	defer cancel()
+	defer func() {
+		err = p.canceledError(err)
+	}()
+
 	inputs, err := plugin.UnmarshalProperties(req.GetProperties(), state.HTTPRequestBodyUnmarshalOpts)
 	if err != nil {
 		return nil, errors.Wrap(err, "unmarshal input properties as propertymap")
 	}
 
+	idempotencyKey := popIdempotencyKey(inputs)
+
 	resourceTypeToken := GetResourceTypeToken(req.GetUrn())
 	crudMap, ok := p.metadata.ResourceCRUDMap[resourceTypeToken]
 	if !ok {
@@ -582,11 +854,19 @@ func (p *Provider) Create(ctx context.Context, req *pulumirpc.CreateRequest) (*p
 		}
 	}
 
+	p.setIdempotencyKeyHeader(httpReq, idempotencyKey)
+
 	preCreateErr := p.providerCallback.OnPreCreate(ctx, req, httpReq)
 	if preCreateErr != nil {
 		return nil, preCreateErr
 	}
 
+	release, err := p.acquireConcurrencySlot(ctx, resourceTypeToken, httpEndpointPath, httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	// Create the resource.
 	httpResp, err := p.httpClient.Do(httpReq)
 	if err != nil {
@@ -602,7 +882,7 @@ func (p *Provider) Create(ctx context.Context, req *pulumirpc.CreateRequest) (*p
 		}
 
 		httpResp.Body.Close()
-		return nil, errors.Errorf("http request failed (status: %s): %s", httpResp.Status, string(body))
+		return nil, p.newAPIError(httpReq, httpResp, body)
 	}
 
 	body, err := io.ReadAll(httpResp.Body)
@@ -613,42 +893,58 @@ func (p *Provider) Create(ctx context.Context, req *pulumirpc.CreateRequest) (*p
 	defer httpResp.Body.Close()
 
 	var outputs interface{}
-	if err := json.Unmarshal(body, &outputs); err != nil {
+	if len(body) == 0 && httpResp.StatusCode == http.StatusAccepted {
+		outputs = make(map[string]interface{})
+	} else if err := json.Unmarshal(body, &outputs); err != nil {
 		return nil, errors.Wrap(err, "unmarshaling the response")
 	}
 
 	logging.V(3).Infof("RESPONSE BODY: %v", outputs)
 
+	// From here on, the resource exists even if the rest of its creation
+	// fails, so it is reported with the outputs that are known.
+	createdState := resource.PropertyMap{}
+	storeIdempotencyKey(createdState, idempotencyKey)
+	initError := func(outputs interface{}, err error) error {
+		return p.newResourceInitError(ctx, resourceTypeToken, crudMap, "", outputs, inputs, createdState, req.GetProperties(), err)
+	}
+
+	if httpResp.StatusCode == http.StatusAccepted {
+		result, err := p.awaitAsyncResourceOperation(ctx, resourceTypeToken, crudMap, httpReq, httpResp, inputs, nil, outputs)
+		if err != nil {
+			return nil, initError(outputs, errors.Wrap(err, "waiting for the resource to be created"))
+		}
+		outputs = result
+	}
+
+	result, err := p.waitForResourceReady(ctx, resourceTypeToken, crudMap, inputs, nil, outputs, req.GetTimeout())
+	if err != nil {
+		return nil, initError(result, err)
+	}
+	outputs = result
+
 	outputsMap, postCreateErr := p.providerCallback.OnPostCreate(ctx, req, outputs)
 	if postCreateErr != nil {
-		// TODO: returning a nil CreateResponse will mean that Pulumi will consider
-		// this resource to not have been created. We should use the outputs we
-		// already have to create the response.
-		return nil, postCreateErr
+		return nil, initError(outputs, postCreateErr)
 	}
 
 	p.TransformBody(ctx, outputsMap, p.metadata.APIToSDKNameMap)
 
-	var outputProperties *structpb.Struct
-	if !p.engineSendsOldInputs {
-		outputProperties, err = plugin.MarshalProperties(state.GetResourceState(outputsMap, inputs), state.DefaultMarshalOpts)
-	} else {
-		outputProperties, err = plugin.MarshalProperties(resource.NewPropertyMapFromMap(outputsMap), state.DefaultMarshalOpts)
-	}
+	outputState := p.getOutputState(outputsMap, inputs)
+	p.preserveWriteOnlyProperties(crudMap, inputs, outputState)
+	p.storeResourceVersion(resourceTypeToken, httpResp, outputState)
+	storeIdempotencyKey(outputState, idempotencyKey)
+	p.markSchemaSecrets(resourceTypeToken, outputState, nil)
 
+	outputProperties, err := plugin.MarshalProperties(outputState, state.DefaultMarshalOpts)
 	if err != nil {
 		return nil, errors.Wrap(err, "marshaling the output properties map")
 	}
 
-	id, ok := outputsMap["id"]
+	id, ok := getResourceID(outputsMap)
 	if !ok {
-		logging.V(3).Infof("id prop not found in top-level response. Checking if an embedded property has it...")
-		// Try plucking the id from top-level properties.
-		id, _, ok = tryPluckingProp("id", outputsMap)
-		if !ok {
-			// TODO: should we return the CreateResponse without the Id property here?
-			return nil, errors.New("resource may have been created successfully but the id was not present in the response")
-		}
+		// TODO: should we return the CreateResponse without the Id property here?
+		return nil, errors.New("resource may have been created successfully but the id was not present in the response")
 	}
 
 	return &pulumirpc.CreateResponse{
@@ -658,7 +954,13 @@ func (p *Provider) Create(ctx context.Context, req *pulumirpc.CreateRequest) (*p
 }
 
 // Read the current live state associated with a resource.
-func (p *Provider) Read(ctx context.Context, req *pulumirpc.ReadRequest) (*pulumirpc.ReadResponse, error) {
+func (p *Provider) Read(ctx context.Context, req *pulumirpc.ReadRequest) (_ *pulumirpc.ReadResponse, err error) {
+	ctx, cancel := p.withCancellation(ctx)
+	defer cancel()
+	defer func() {
+		err = p.canceledError(err)
+	}()
+
 	inputs, err := plugin.UnmarshalProperties(req.GetInputs(), state.DefaultUnmarshalOpts)
 	if err != nil {
 		return nil, errors.Wrap(err, "unmarshal current inputs")
@@ -738,16 +1040,6 @@ func (p *Provider) Read(ctx context.Context, req *pulumirpc.ReadRequest) (*pulum
 		return nil, errors.Wrap(err, "executing http request")
 	}
 
-	if httpResp.StatusCode != http.StatusOK {
-		body, err := io.ReadAll(httpResp.Body)
-		if err != nil {
-			return nil, errors.Wrap(err, "http request failed and the error response could not be read")
-		}
-
-		httpResp.Body.Close()
-		return nil, errors.Errorf("http request failed (status: %s): %s", httpResp.Status, string(body))
-	}
-
 	body, err := io.ReadAll(httpResp.Body)
 	if err != nil {
 		return nil, errors.Wrap(err, "reading response body")
@@ -755,6 +1047,18 @@ func (p *Provider) Read(ctx context.Context, req *pulumirpc.ReadRequest) (*pulum
 
 	defer httpResp.Body.Close()
 
+	// Per the provider protocol, a resource that no longer exists
+	// is reported by returning an empty ID so that the engine
+	// can remove it from the state.
+	if p.isResourceNotFound(resourceTypeToken, httpResp.StatusCode, body) {
+		logging.V(3).Infof("Resource %s no longer exists (status: %s)", req.GetUrn(), httpResp.Status)
+		return &pulumirpc.ReadResponse{Id: ""}, nil
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, p.newAPIError(httpReq, httpResp, body)
+	}
+
 	var outputs interface{}
 	if err := json.Unmarshal(body, &outputs); err != nil {
 		return nil, errors.Wrap(err, "unmarshaling the response")
@@ -765,6 +1069,8 @@ func (p *Provider) Read(ctx context.Context, req *pulumirpc.ReadRequest) (*pulum
 		return nil, postReadErr
 	}
 
+	priorInputs := inputs.Copy()
+
 	// If there is no old state, then persist the current outputs as the
 	// "old" inputs for this resource.
 	if len(inputs) == 0 {
@@ -844,14 +1150,17 @@ func (p *Provider) Read(ctx context.Context, req *pulumirpc.ReadRequest) (*pulum
 
 	p.TransformBody(ctx, outputsMap, p.metadata.APIToSDKNameMap)
 
-	var outputProperties *structpb.Struct
-	if !p.engineSendsOldInputs {
-		// Stash a copy of the current inputs in the serialized outputs.
-		outputProperties, err = plugin.MarshalProperties(state.GetResourceState(outputsMap, inputs), state.DefaultMarshalOpts)
-	} else {
-		outputProperties, err = plugin.MarshalProperties(resource.NewPropertyMapFromMap(outputsMap), state.DefaultMarshalOpts)
-	}
+	// The API never returns the values of writeOnly properties
+	// so keep their prior values instead of reporting drift.
+	p.preserveWriteOnlyProperties(crudMap, priorInputs, inputs)
 
+	// Stash a copy of the current inputs in the serialized outputs.
+	outputState := p.getOutputState(outputsMap, inputs)
+	p.preserveWriteOnlyProperties(crudMap, currentState, outputState)
+	p.storeResourceVersion(resourceTypeToken, httpResp, outputState)
+	p.markSchemaSecrets(resourceTypeToken, outputState, inputs)
+
+	outputProperties, err := plugin.MarshalProperties(outputState, state.DefaultMarshalOpts)
 	if err != nil {
 		return nil, errors.Wrap(err, "marshaling the output properties map")
 	}
@@ -880,7 +1189,13 @@ func (p *Provider) Read(ctx context.Context, req *pulumirpc.ReadRequest) (*pulum
 }
 
 // Update updates an existing resource with new values.
-func (p *Provider) Update(ctx context.Context, req *pulumirpc.UpdateRequest) (*pulumirpc.UpdateResponse, error) {
+func (p *Provider) Update(ctx context.Context, req *pulumirpc.UpdateRequest) (_ *pulumirpc.UpdateResponse, err error) {
+	ctx, cancel := p.withOperationTimeout(ctx, req.GetTimeout())
+	defer cancel()
+	defer func() {
+		err = p.canceledError(err)
+	}()
+
 	oldState, err := plugin.UnmarshalProperties(req.GetOlds(), state.HTTPRequestBodyUnmarshalOpts)
 	if err != nil {
 		return nil, errors.Wrap(err, "unmarshal olds as propertymap")
@@ -909,6 +1224,13 @@ func (p *Provider) Update(ctx context.Context, req *pulumirpc.UpdateRequest) (*p
 		return nil, errors.Wrap(err, "unmarshal old inputs as propertymap")
 	}
 
+	// The idempotency key is only sent with create requests.
+	popIdempotencyKey(inputs)
+	popIdempotencyKey(oldInputs)
+
+	// Default values that Check set are only sent if they were changed.
+	p.applyDefaults(crudMap, oldInputs)
+
 	if crudMap.U != nil {
 		logging.V(3).Infof("Using PATCH endpoint to update resource %s", resourceTypeToken)
 		httpEndpointPath = *crudMap.U
@@ -945,7 +1267,7 @@ func (p *Provider) Update(ctx context.Context, req *pulumirpc.UpdateRequest) (*p
 			return nil, errors.Wrap(err, "marshaling inputs")
 		}
 
-		if p.engineSendsOldInputs {
+		if p.config().engineSendsOldInputs {
 			httpReq, httpReqErr = p.createHTTPRequestWithBody(ctx, httpEndpointPath, http.MethodPatch, bodyBytes, oldState, oldInputs)
 		} else {
 			httpReq, httpReqErr = p.CreatePatchRequest(ctx, httpEndpointPath, bodyBytes, oldState)
@@ -961,7 +1283,7 @@ func (p *Provider) Update(ctx context.Context, req *pulumirpc.UpdateRequest) (*p
 
 		logging.V(3).Infof("Using PUT endpoint to update resource %s", resourceTypeToken)
 		httpEndpointPath = *crudMap.P
-		if p.engineSendsOldInputs {
+		if p.config().engineSendsOldInputs {
 			httpReq, httpReqErr = p.createHTTPRequestWithBody(ctx, httpEndpointPath, http.MethodPut, bodyBytes, oldState, oldInputs)
 		} else {
 			httpReq, httpReqErr = p.CreatePutRequest(ctx, httpEndpointPath, bodyBytes, oldState)
@@ -971,21 +1293,25 @@ func (p *Provider) Update(ctx context.Context, req *pulumirpc.UpdateRequest) (*p
 		}
 	}
 
+	p.setIfMatchHeader(resourceTypeToken, httpReq, oldState)
+
 	preUpdateErr := p.providerCallback.OnPreUpdate(ctx, req, httpReq)
 	if preUpdateErr != nil {
 		return nil, preUpdateErr
 	}
 
+	release, err := p.acquireConcurrencySlot(ctx, resourceTypeToken, httpEndpointPath, httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	// Update the resource.
 	httpResp, err := p.httpClient.Do(httpReq)
 	if err != nil {
 		return nil, errors.Wrap(err, "executing http request")
 	}
 
-	if httpResp.StatusCode != http.StatusOK && httpResp.StatusCode != http.StatusNoContent {
-		return nil, errors.Errorf("http request failed: %v. expected 200 or 204 but got %d", err, httpResp.StatusCode)
-	}
-
 	body, err := io.ReadAll(httpResp.Body)
 	if err != nil {
 		return nil, errors.Wrap(err, "reading response body")
@@ -993,31 +1319,60 @@ func (p *Provider) Update(ctx context.Context, req *pulumirpc.UpdateRequest) (*p
 
 	defer httpResp.Body.Close()
 
+	if httpResp.StatusCode != http.StatusOK &&
+		httpResp.StatusCode != http.StatusNoContent &&
+		httpResp.StatusCode != http.StatusAccepted {
+		return nil, p.newMutationAPIError(resourceTypeToken, httpReq, httpResp, body)
+	}
+
 	if httpResp.StatusCode == http.StatusNoContent {
 		return &pulumirpc.UpdateResponse{}, nil
 	}
 
 	var outputs interface{}
-	if err := json.Unmarshal(body, &outputs); err != nil {
+	if len(body) == 0 && httpResp.StatusCode == http.StatusAccepted {
+		outputs = make(map[string]interface{})
+	} else if err := json.Unmarshal(body, &outputs); err != nil {
 		return nil, errors.Wrap(err, "unmarshaling the response")
 	}
 
 	logging.V(3).Infof("RESPONSE BODY: %v", outputs)
 
+	// The update was accepted, so the state of the resource is reported
+	// even if the rest of the update fails.
+	initError := func(outputs interface{}, err error) error {
+		return p.newResourceInitError(ctx, resourceTypeToken, crudMap, req.GetId(), outputs, inputs, oldState, req.GetNews(), err)
+	}
+
+	if httpResp.StatusCode == http.StatusAccepted {
+		result, err := p.awaitAsyncResourceOperation(ctx, resourceTypeToken, crudMap, httpReq, httpResp, inputs, oldState, outputs)
+		if err != nil {
+			return nil, initError(outputs, errors.Wrap(err, "waiting for the resource to be updated"))
+		}
+		outputs = result
+	}
+
+	result, err := p.waitForResourceReady(ctx, resourceTypeToken, crudMap, inputs, oldState, outputs, req.GetTimeout())
+	if err != nil {
+		return nil, initError(result, err)
+	}
+	outputs = result
+
 	outputsMap, postUpdateErr := p.providerCallback.OnPostUpdate(ctx, req, *httpReq, outputs)
 	if postUpdateErr != nil {
-		return nil, postUpdateErr
+		return nil, initError(outputs, postUpdateErr)
 	}
 
 	p.TransformBody(ctx, outputsMap, p.metadata.APIToSDKNameMap)
 
-	var outputProperties *structpb.Struct
-	if !p.engineSendsOldInputs {
-		// TODO: Could this erase refreshed inputs that were previously saved in outputs state?
-		outputProperties, err = plugin.MarshalProperties(state.GetResourceState(outputsMap, inputs), state.DefaultMarshalOpts)
-	} else {
-		outputProperties, err = plugin.MarshalProperties(resource.NewPropertyMapFromMap(outputsMap), state.DefaultMarshalOpts)
-	}
+	// TODO: Could this erase refreshed inputs that were previously saved in outputs state?
+	outputState := p.getOutputState(outputsMap, inputs)
+	p.preserveWriteOnlyProperties(crudMap, inputs, outputState)
+	p.storeResourceVersion(resourceTypeToken, httpResp, outputState)
+	storeIdempotencyKey(outputState, state.GetIdempotencyKey(oldState))
+	p.markSchemaSecrets(resourceTypeToken, outputState, nil)
+
+	outputProperties, err := plugin.MarshalProperties(outputState, state.DefaultMarshalOpts)
 	if err != nil {
 		return nil, errors.Wrap(err, "marshaling the output properties map")
 	}
@@ -1029,7 +1384,13 @@ func (p *Provider) Update(ctx context.Context, req *pulumirpc.UpdateRequest) (*p
 
 // Delete tears down an existing resource with the given ID. If it fails, the resource is assumed
 // to still exist.
-func (p *Provider) Delete(ctx context.Context, req *pulumirpc.DeleteRequest) (*pbempty.Empty, error) {
+func (p *Provider) Delete(ctx context.Context, req *pulumirpc.DeleteRequest) (_ *pbempty.Empty, err error) {
+	ctx, cancel := p.withOperationTimeout(ctx, req.GetTimeout())
+	defer cancel()
+	defer func() {
+		err = p.canceledError(err)
+	}()
+
 	inputs, err := plugin.UnmarshalProperties(req.GetProperties(), state.HTTPRequestBodyUnmarshalOpts)
 	if err != nil {
 		return nil, errors.Wrap(err, "unmarshal input properties as propertymap")
@@ -1051,8 +1412,9 @@ func (p *Provider) Delete(ctx context.Context, req *pulumirpc.DeleteRequest) (*p
 	var httpEndpointPath = *crudMap.D
 	var httpReq *http.Request
 	var httpReqErr error
-	if p.engineSendsOldInputs {
-		oldInputs, err := plugin.UnmarshalProperties(req.GetOldInputs(), state.HTTPRequestBodyUnmarshalOpts)
+	var oldInputs resource.PropertyMap
+	if p.config().engineSendsOldInputs {
+		oldInputs, err = plugin.UnmarshalProperties(req.GetOldInputs(), state.HTTPRequestBodyUnmarshalOpts)
 		if err != nil {
 			return nil, errors.Wrap(err, "unmarshal old inputs as propertymap")
 		}
@@ -1064,22 +1426,50 @@ func (p *Provider) Delete(ctx context.Context, req *pulumirpc.DeleteRequest) (*p
 		return nil, errors.Wrapf(httpReqErr, "creating delete request (type token: %s)", resourceTypeToken)
 	}
 
+	p.setIfMatchHeader(resourceTypeToken, httpReq, inputs)
+
 	preErr := p.providerCallback.OnPreDelete(ctx, req, httpReq)
 	if preErr != nil {
 		return nil, preErr
 	}
 
+	release, err := p.acquireConcurrencySlot(ctx, resourceTypeToken, httpEndpointPath, httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	// Delete the resource.
 	httpResp, err := p.httpClient.Do(httpReq)
 	if err != nil {
 		return nil, errors.Wrap(err, "executing http request")
 	}
 
-	if !slices.Contains(validStatusCodesForDelete, httpResp.StatusCode) {
-		return nil, errors.Errorf("http request failed: %v. expected one of %v but got %d", err, validStatusCodesForDelete, httpResp.StatusCode)
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading response body")
 	}
 
-	defer httpResp.Body.Close()
+	switch {
+	case slices.Contains(alreadyDeletedStatusCodes, httpResp.StatusCode) ||
+		(httpResp.StatusCode >= http.StatusBadRequest && p.isResourceNotFound(resourceTypeToken, httpResp.StatusCode, body)):
+		// Deleting a resource that no longer exists is not an error.
+		logging.V(3).Infof("Resource %s was already deleted (status: %s)", req.GetUrn(), httpResp.Status)
+	case !slices.Contains(validStatusCodesForDelete, httpResp.StatusCode):
+		return nil, p.newMutationAPIError(resourceTypeToken, httpReq, httpResp, body)
+	default:
+		if httpResp.StatusCode == http.StatusAccepted {
+			if err := p.awaitAsyncDeleteOperation(ctx, resourceTypeToken, crudMap, httpReq, httpResp, body, inputs, oldInputs); err != nil {
+				return nil, errors.Wrap(err, "waiting for the resource to be deleted")
+			}
+		}
+
+		if err := p.waitForResourceDeletion(ctx, resourceTypeToken, crudMap, inputs, oldInputs); err != nil {
+			return nil, err
+		}
+	}
 
 	postDeleteErr := p.providerCallback.OnPostDelete(ctx, req)
 	if postDeleteErr != nil {
@@ -1114,11 +1504,14 @@ func (p *Provider) GetSchema(_ context.Context, _ *pulumirpc.GetSchemaRequest) (
 // it is up to the host to decide how long to wait after Cancel is called before (e.g.)
 // hard-closing any gRPC connection.
 func (p *Provider) Cancel(context.Context, *pbempty.Empty) (*pbempty.Empty, error) {
+	p.cancel()
 	return &pbempty.Empty{}, nil
 }
 
 func (p *Provider) GetOpenAPIDoc() openapi3.T {
-	return p.openAPIDoc
+	doc := p.openAPIDoc
+	doc.Servers = p.config().servers
+	return doc
 }
 
 func (p *Provider) GetSchemaSpec() pschema.PackageSpec {
@@ -1126,7 +1519,7 @@ func (p *Provider) GetSchemaSpec() pschema.PackageSpec {
 }
 
 func (p *Provider) GetBaseURL() string {
-	return p.baseURL
+	return p.config().baseURL
 }
 
 func (p *Provider) GetHTTPClient() *http.Client {
@@ -8,7 +8,9 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/cloudy-sky-software/pulumi-provider-framework/callback"
 	"github.com/cloudy-sky-software/pulumi-provider-framework/openapi"
@@ -16,6 +18,7 @@ import (
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
 	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
@@ -255,6 +258,51 @@ func TestDiffForUpdateableResource(t *testing.T) {
 	assert.Contains(t, diffResp.Diffs, "simpleProp")
 }
 
+func TestDetailedDiffForNestedProperties(t *testing.T) {
+	ctx := context.Background()
+
+	oldInputsJSON := `{
+		"simpleProp": "a value",
+		"objectProp": {
+			"anotherProp": "a value"
+		},
+		"tags": ["a", "b", "c"]
+	}`
+
+	newInputsJSON := `{
+		"objectProp": {
+			"anotherProp": "new value",
+			"unknownProp": "a value"
+		},
+		"tags": ["a", "b", "d"]
+	}`
+
+	p := makeTestGenericProvider(ctx, t, nil, nil)
+
+	diffResp, err := p.Diff(ctx, &pulumirpc.DiffRequest{
+		Id:        "fake-id",
+		News:      getMarshaledProps(t, newInputsJSON),
+		OldInputs: getMarshaledProps(t, oldInputsJSON),
+		Urn:       "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
+	})
+	require.NoError(t, err)
+	assert.True(t, diffResp.GetHasDetailedDiff())
+
+	kinds := make(map[string]pulumirpc.PropertyDiff_Kind)
+	for path, propDiff := range diffResp.GetDetailedDiff() {
+		kinds[path] = propDiff.GetKind()
+	}
+
+	assert.Equal(t, map[string]pulumirpc.PropertyDiff_Kind{
+		"simpleProp":             pulumirpc.PropertyDiff_DELETE,
+		"objectProp.anotherProp": pulumirpc.PropertyDiff_UPDATE,
+		"objectProp.unknownProp": pulumirpc.PropertyDiff_ADD_REPLACE,
+		"tags[2]":                pulumirpc.PropertyDiff_UPDATE,
+	}, kinds)
+	assert.Equal(t, []string{"objectProp"}, diffResp.GetReplaces())
+	assert.Equal(t, []string{"objectProp", "simpleProp", "tags"}, diffResp.GetDiffs())
+}
+
 func TestUpdateForUpdateableResource(t *testing.T) {
 	ctx := context.Background()
 
@@ -602,3 +650,202 @@ func TestUpdateLegacyPath(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Contains(t, outputState, resource.PropertyKey("__inputs"), "Legacy path should embed __inputs in output state")
 }
+
+func TestReadOfDeletedResource(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		hint       *NotFoundHint
+	}{
+		{
+			name:       "NotFound",
+			statusCode: http.StatusNotFound,
+			body:       `{"message":"not found"}`,
+		},
+		{
+			name:       "GoneWithHint",
+			statusCode: http.StatusGone,
+			body:       `{"message":"gone"}`,
+			hint:       &NotFoundHint{StatusCodes: []int{http.StatusGone}},
+		},
+		{
+			name:       "DeletedPropertyWithHint",
+			statusCode: http.StatusOK,
+			body:       `{"id":"fake-id","deleted":true}`,
+			hint:       &NotFoundHint{BodyProperty: "deleted", BodyValues: []string{"true"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == fakeResourceURLPath {
+					w.WriteHeader(test.statusCode)
+					_, _ = io.WriteString(w, test.body)
+					return
+				}
+
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			testServer.EnableHTTP2 = true
+			testServer.Start()
+			defer testServer.Close()
+
+			p := makeTestGenericProvider(ctx, t, testServer, nil)
+			if test.hint != nil {
+				p.(*Provider).frameworkMetadata.NotFoundMap = map[string]NotFoundHint{
+					"generic:fakeresource/v2:FakeResource": *test.hint,
+				}
+			}
+
+			serializedOutputState, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(map[string]any{
+				"id":          "fake-id",
+				"anotherProp": "output value",
+			}), state.DefaultMarshalOpts)
+			assert.Nil(t, err)
+
+			readResp, err := p.Read(ctx, &pulumirpc.ReadRequest{
+				Id:         "fake-id",
+				Properties: serializedOutputState,
+				Urn:        "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
+			})
+			assert.Nil(t, err)
+			assert.NotNil(t, readResp)
+			assert.Empty(t, readResp.GetId(), "Expected an empty id for a resource that no longer exists")
+			assert.Nil(t, readResp.GetProperties())
+		})
+	}
+}
+
+func TestReadFailsForUnexpectedGone(t *testing.T) {
+	ctx := context.Background()
+
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+
+	_, err := p.Read(ctx, &pulumirpc.ReadRequest{
+		Id:  "/fake-id",
+		Urn: "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
+	})
+	assert.Error(t, err, "Expected 410 to be an error without a not-found hint")
+}
+
+func deleteFakeResource(ctx context.Context, t *testing.T, p pulumirpc.ResourceProviderServer) error {
+	t.Helper()
+
+	props, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(map[string]any{
+		"id":          "fake-id",
+		"anotherProp": "output value",
+	}), state.DefaultMarshalOpts)
+	assert.Nil(t, err)
+
+	_, err = p.Delete(ctx, &pulumirpc.DeleteRequest{
+		Id:         "fake-id",
+		Properties: props,
+		OldInputs:  getMarshaledProps(t, `{"simpleProp":"a value"}`),
+		Urn:        "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
+	})
+	return err
+}
+
+func TestDeleteOfAlreadyDeletedResource(t *testing.T) {
+	ctx := context.Background()
+
+	for _, statusCode := range []int{http.StatusNotFound, http.StatusGone} {
+		t.Run(http.StatusText(statusCode), func(t *testing.T) {
+			testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == fakeResourceURLPath && r.Method == http.MethodDelete {
+					w.WriteHeader(statusCode)
+					return
+				}
+
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			testServer.EnableHTTP2 = true
+			testServer.Start()
+			defer testServer.Close()
+
+			p := makeTestGenericProvider(ctx, t, testServer, nil)
+			assert.Nil(t, deleteFakeResource(ctx, t, p))
+		})
+	}
+}
+
+func TestDeleteWaitsUntilResourceIsRemoved(t *testing.T) {
+	ctx := context.Background()
+
+	var readCount atomic.Int32
+
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != fakeResourceURLPath {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodGet:
+			if readCount.Add(1) < 3 {
+				_, _ = io.WriteString(w, `{"id":"fake-id","another_prop":"deleting"}`)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	p.(*Provider).asyncPollInterval = time.Millisecond
+	p.(*Provider).frameworkMetadata.DeletionWaiterMap = map[string]DeletionWaiterHint{
+		"generic:fakeresource/v2:FakeResource": {},
+	}
+
+	assert.Nil(t, deleteFakeResource(ctx, t, p))
+	assert.Equal(t, int32(3), readCount.Load(), "Expected the resource to be read until it was no longer found")
+}
+
+// failingConfigureProviderCallback fails the configuration of the provider
+// once fail is set.
+type failingConfigureProviderCallback struct {
+	fakeProviderCallback
+
+	fail bool
+}
+
+func (p *failingConfigureProviderCallback) OnConfigure(ctx context.Context, req *pulumirpc.ConfigureRequest) (*pulumirpc.ConfigureResponse, error) {
+	if p.fail {
+		return nil, fmt.Errorf("configure failed")
+	}
+
+	return p.fakeProviderCallback.OnConfigure(ctx, req)
+}
+
+func TestFailedConfigureDoesNotChangeTransports(t *testing.T) {
+	ctx := context.Background()
+
+	providerCallback := &failingConfigureProviderCallback{}
+	p := makeTestGenericProvider(ctx, t, nil, providerCallback).(*Provider)
+	providerCallback.fail = true
+
+	_, err := p.Configure(ctx, &pulumirpc.ConfigureRequest{
+		Variables: map[string]string{
+			"generic:config:retryMaxAttempts": "2",
+			"generic:config:rateLimits":       `[{"requestsPerSecond":2}]`,
+		},
+	})
+	require.Error(t, err)
+	assert.Equal(t, DefaultRetryPolicy().MaxAttempts, p.retryTransport.getPolicy().MaxAttempts)
+	assert.Empty(t, p.rateLimitTransport.rules)
+}
@@ -1,67 +1,340 @@
 package rest
 
 import (
-	"bytes"
-	"io"
+	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/pulumi/pulumi/sdk/v3/go/common/util/logging"
 )
 
-// rateLimitTransport is an http.RoundTripper that handles HTTP 429 Too Many
-// Requests responses by respecting the Retry-After header. If the header value
-// is a non-negative decimal integer, the request is retried after that many
-// seconds. If the header is absent or not a valid non-negative integer, the
-// 429 response is returned to the caller as-is.
+const (
+	headerXRateLimitRemaining = "X-RateLimit-Remaining"
+	headerXRateLimitReset     = "X-RateLimit-Reset"
+	headerRateLimitRemaining  = "RateLimit-Remaining"
+	headerRateLimitReset      = "RateLimit-Reset"
+	headerRateLimit           = "RateLimit"
+)
+
+// RateLimitRule limits the rate at which requests are sent to the API.
+// Every rule that matches a request applies to it, so a rule for all
+// requests to a host can be combined with a stricter one for writes.
+type RateLimitRule struct {
+	// Host is the host of the requests that the rule applies to, e.g.
+	// `api.example.com`. The rule applies to every host if empty, with
+	// a separate limit for each host.
+	Host string `json:"host,omitempty"`
+	// Method is the HTTP method of the requests that the rule applies
+	// to. The rule applies to every method if empty.
+	Method string `json:"method,omitempty"`
+	// RequestsPerSecond is the sustained rate of requests.
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	// Burst is the number of requests that can be sent at once.
+	// Defaults to 1.
+	Burst int `json:"burst,omitempty"`
+}
+
+func (r RateLimitRule) matches(req *http.Request) bool {
+	return (r.Host == "" || strings.EqualFold(r.Host, req.URL.Host)) &&
+		(r.Method == "" || strings.EqualFold(r.Method, req.Method))
+}
+
+// tokenBucket paces requests at a rate with bursts of up to burst
+// requests. The rate is lowered temporarily when the API advertises
+// that fewer requests remain in its current rate limit window.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	// adaptedRate is the rate at which the API's remaining requests
+	// last until adaptedUntil, when its rate limit window resets.
+	adaptedRate  float64
+	adaptedUntil time.Time
+	// pausedUntil is when the API's rate limit window resets after
+	// no requests remain.
+	pausedUntil time.Time
+}
+
+func newTokenBucket(rule RateLimitRule, now time.Time) *tokenBucket {
+	burst := float64(max(rule.Burst, 1))
+	return &tokenBucket{
+		rate:   rule.RequestsPerSecond,
+		burst:  burst,
+		tokens: burst,
+		last:   now,
+	}
+}
+
+func (b *tokenBucket) currentRate(now time.Time) float64 {
+	if now.Before(b.adaptedUntil) && b.adaptedRate > 0 {
+		return min(b.rate, b.adaptedRate)
+	}
+
+	return b.rate
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if now.Before(b.pausedUntil) {
+		b.last = now
+		return
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed*b.currentRate(now))
+	}
+	b.last = now
+}
+
+// reserve takes a token from the bucket and returns how long to wait
+// before the request that took it can be sent.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens--
+
+	var wait time.Duration
+	if now.Before(b.pausedUntil) {
+		wait = b.pausedUntil.Sub(now)
+	}
+
+	if b.tokens >= 0 {
+		return wait
+	}
+
+	rate := b.currentRate(now.Add(wait))
+	if rate <= 0 {
+		return wait
+	}
+
+	return wait + time.Duration(-b.tokens/rate*float64(time.Second))
+}
+
+// refund returns the token taken by a reservation whose request was not
+// sent.
+func (b *tokenBucket) refund() {
+	b.tokens = min(b.burst, b.tokens+1)
+}
+
+// adapt lowers the rate of the bucket so that the remaining requests of
+// the API's rate limit window last until the window resets.
+func (b *tokenBucket) adapt(remaining int, reset time.Duration, now time.Time) {
+	b.refill(now)
+	b.tokens = min(b.tokens, float64(remaining))
+
+	if reset <= 0 {
+		return
+	}
+
+	if remaining == 0 {
+		b.pausedUntil = now.Add(reset)
+		return
+	}
+
+	b.adaptedRate = float64(remaining) / reset.Seconds()
+	b.adaptedUntil = now.Add(reset)
+}
+
+type tokenBucketKey struct {
+	rule int
+	host string
+}
+
+// rateLimitTransport is an http.RoundTripper that paces requests with a
+// token bucket for each RateLimitRule that matches them, so that they are
+// sent before the API starts refusing them with HTTP 429 responses.
+//
+// The rates adapt to the X-RateLimit-Remaining/X-RateLimit-Reset and
+// RateLimit-* headers of the responses. Only the buckets of rules are
+// adapted, so requests that no rule matches are never paced, and a 429
+// response to them is left to the retryTransport.
 type rateLimitTransport struct {
 	wrapped http.RoundTripper
+
+	mu      sync.Mutex
+	rules   []RateLimitRule
+	buckets map[tokenBucketKey]*tokenBucket
 }
 
-func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	for {
-		resp, err := t.wrapped.RoundTrip(req)
-		if err != nil {
-			return nil, err
+func newRateLimitTransport(wrapped http.RoundTripper, rules []RateLimitRule) *rateLimitTransport {
+	return &rateLimitTransport{
+		wrapped: wrapped,
+		rules:   rules,
+		buckets: make(map[tokenBucketKey]*tokenBucket),
+	}
+}
+
+// setRules replaces the rules of the transport and resets its buckets.
+func (t *rateLimitTransport) setRules(rules []RateLimitRule) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rules = rules
+	t.buckets = make(map[tokenBucketKey]*tokenBucket)
+}
+
+// getBuckets returns the buckets of the rules that match req.
+func (t *rateLimitTransport) getBuckets(req *http.Request, now time.Time) []*tokenBucket {
+	var buckets []*tokenBucket
+	for i, rule := range t.rules {
+		if !rule.matches(req) || rule.RequestsPerSecond <= 0 {
+			continue
 		}
 
-		if resp.StatusCode != http.StatusTooManyRequests {
-			return resp, nil
+		key := tokenBucketKey{rule: i, host: strings.ToLower(req.URL.Host)}
+		bucket, ok := t.buckets[key]
+		if !ok {
+			bucket = newTokenBucket(rule, now)
+			t.buckets[key] = bucket
 		}
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	t.mu.Lock()
+	now := time.Now()
+	buckets := t.getBuckets(req, now)
+	var wait time.Duration
+	for _, bucket := range buckets {
+		wait = max(wait, bucket.reserve(now))
+	}
+	t.mu.Unlock()
 
-		// Read the 429 response body so we can restore it if we cannot retry.
-		respBody, readErr := io.ReadAll(resp.Body)
-		resp.Body.Close()
-
-		retryAfterStr := strings.TrimSpace(resp.Header.Get("Retry-After"))
-		delay, parseErr := strconv.Atoi(retryAfterStr)
-		if parseErr != nil || delay < 0 {
-			// Retry-After header is absent, not a valid integer, or negative.
-			// Restore the body and return the 429 response to the caller.
-			resp.Body = io.NopCloser(bytes.NewReader(respBody))
-			if readErr != nil {
-				return nil, errors.Wrap(readErr, "reading 429 response body")
+	if wait > 0 {
+		logging.V(3).Infof("Delaying %s %s by %v to stay within the rate limit", req.Method, redactURL(req.URL), wait)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			// The request is not sent, so the next requests don't
+			// have to wait for it.
+			t.mu.Lock()
+			for _, bucket := range buckets {
+				bucket.refund()
 			}
-			return resp, nil
+			t.mu.Unlock()
+			return nil, ctx.Err()
+		case <-timer.C:
 		}
+	}
 
-		logging.V(3).Infof("Received 429 response. Retrying after %d second(s)...", delay)
+	resp, err := t.wrapped.RoundTrip(req)
+	if err != nil || len(buckets) == 0 {
+		return resp, err
+	}
 
-		select {
-		case <-req.Context().Done():
-			return nil, req.Context().Err()
-		case <-time.After(time.Duration(delay) * time.Second):
+	now = time.Now()
+	if remaining, reset, ok := parseRateLimitHeaders(resp.Header, now); ok {
+		t.mu.Lock()
+		for _, bucket := range buckets {
+			bucket.adapt(remaining, reset, now)
 		}
+		t.mu.Unlock()
+	}
+
+	return resp, nil
+}
+
+// parseRateLimitHeaders returns the number of requests that remain in
+// the API's current rate limit window and the time until it resets.
+func parseRateLimitHeaders(h http.Header, now time.Time) (int, time.Duration, bool) {
+	for _, names := range [][2]string{
+		{headerRateLimitRemaining, headerRateLimitReset},
+		{headerXRateLimitRemaining, headerXRateLimitReset},
+	} {
+		remaining, err := strconv.Atoi(h.Get(names[0]))
+		if err != nil || remaining < 0 {
+			continue
+		}
+
+		reset, _ := parseRateLimitReset(h.Get(names[1]), now)
+		return remaining, reset, true
+	}
 
-		// Reset the request body for the retry if possible.
-		if req.GetBody != nil {
-			req.Body, err = req.GetBody()
-			if err != nil {
-				return nil, errors.Wrap(err, "resetting request body for retry")
+	// The RateLimit header combines both values, e.g.
+	// `limit=100, remaining=50, reset=30` or `"default";r=50;t=30`.
+	if v := h.Get(headerRateLimit); v != "" {
+		remaining := -1
+		var reset time.Duration
+		for _, param := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ';' }) {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok {
+				continue
 			}
+
+			switch name {
+			case "r", "remaining":
+				if n, err := strconv.Atoi(value); err == nil {
+					remaining = n
+				}
+			case "t", "reset":
+				reset, _ = parseRateLimitReset(value, now)
+			}
+		}
+
+		if remaining >= 0 {
+			return remaining, reset, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+// parseRateLimitReset parses the time until a rate limit window resets,
+// which is either a number of seconds or, as some APIs do, a Unix
+// timestamp.
+func parseRateLimitReset(v string, now time.Time) (time.Duration, bool) {
+	n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) {
+		return 0, false
+	}
+
+	// A value this large can't be a number of seconds.
+	const minUnixTimestamp = 1_000_000_000
+	if n >= minUnixTimestamp {
+		return max(time.Unix(int64(n), 0).Sub(now), 0), true
+	}
+
+	return time.Duration(n * float64(time.Second)), true
+}
+
+// configureRateLimits sets the rate limit rules of the provider config
+// from the provider config. To set via pulumi config, this is
+// "providername:rateLimits", a JSON list of rules such as
+// `[{"method":"POST","requestsPerSecond":2}]`.
+func (p *Provider) configureRateLimits(vars map[string]string, cfg *providerConfig) error {
+	if p.rateLimitTransport == nil {
+		return nil
+	}
+
+	v, ok := vars[fmt.Sprintf("%s:config:rateLimits", p.name)]
+	if !ok {
+		return nil
+	}
+
+	var rules []RateLimitRule
+	if err := json.Unmarshal([]byte(v), &rules); err != nil {
+		return errors.Wrapf(err, "invalid value for rateLimits %q", v)
+	}
+	for _, rule := range rules {
+		if rule.RequestsPerSecond <= 0 {
+			return errors.Errorf("invalid value for rateLimits %q: requestsPerSecond must be positive", v)
 		}
 	}
+
+	cfg.rateLimitRules = rules
+
+	logging.V(3).Infof("Rate limits: %v", rules)
+	return nil
 }
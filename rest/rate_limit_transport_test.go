@@ -5,8 +5,11 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -14,176 +17,205 @@ import (
 	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
 )
 
-const fakeResourceURLPath = "/v2/fakeresource/fake-id"
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(RateLimitRule{RequestsPerSecond: 2}, now)
+
+	assert.Equal(t, time.Duration(0), b.reserve(now))
+	assert.Equal(t, 500*time.Millisecond, b.reserve(now))
+	assert.Equal(t, time.Second, b.reserve(now))
+
+	// The bucket refills up to its burst.
+	now = now.Add(time.Minute)
+	assert.Equal(t, time.Duration(0), b.reserve(now))
+	assert.Equal(t, 500*time.Millisecond, b.reserve(now))
+
+	// No requests are sent until the API's rate limit window resets.
+	now = now.Add(time.Minute)
+	b.adapt(0, 10*time.Second, now)
+	assert.Equal(t, 10*time.Second+500*time.Millisecond, b.reserve(now))
+
+	// The rate is lowered so that the remaining requests last until
+	// the window resets.
+	now = now.Add(time.Minute)
+	b.adapt(1, 4*time.Second, now)
+	assert.Equal(t, time.Duration(0), b.reserve(now))
+	assert.Equal(t, 4*time.Second, b.reserve(now))
+}
 
-// TestRateLimitTransportRetryWithRetryAfterInteger verifies that when a 429
-// response is received with a valid non-negative integer Retry-After header,
-// the request is retried and ultimately succeeds.
-func TestRateLimitTransportRetryWithRetryAfterInteger(t *testing.T) {
-	ctx := context.Background()
+func TestParseRateLimitHeaders(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name              string
+		headers           map[string]string
+		expectedRemaining int
+		expectedReset     time.Duration
+		expectedOK        bool
+	}{
+		{
+			name:              "X-RateLimit headers",
+			headers:           map[string]string{headerXRateLimitRemaining: "10", headerXRateLimitReset: "30"},
+			expectedRemaining: 10,
+			expectedReset:     30 * time.Second,
+			expectedOK:        true,
+		},
+		{
+			name:              "X-RateLimit-Reset as a Unix timestamp",
+			headers:           map[string]string{headerXRateLimitRemaining: "0", headerXRateLimitReset: strconv.FormatInt(now.Add(time.Minute).Unix(), 10)},
+			expectedRemaining: 0,
+			expectedReset:     now.Add(time.Minute).Truncate(time.Second).Sub(now),
+			expectedOK:        true,
+		},
+		{
+			name:              "RateLimit headers",
+			headers:           map[string]string{headerRateLimitRemaining: "5", headerRateLimitReset: "2"},
+			expectedRemaining: 5,
+			expectedReset:     2 * time.Second,
+			expectedOK:        true,
+		},
+		{
+			name:              "combined RateLimit header",
+			headers:           map[string]string{headerRateLimit: "limit=100, remaining=50, reset=5"},
+			expectedRemaining: 50,
+			expectedReset:     5 * time.Second,
+			expectedOK:        true,
+		},
+		{
+			name:              "structured RateLimit header",
+			headers:           map[string]string{headerRateLimit: `"default";r=3;t=7`},
+			expectedRemaining: 3,
+			expectedReset:     7 * time.Second,
+			expectedOK:        true,
+		},
+		{
+			name:       "no headers",
+			headers:    map[string]string{},
+			expectedOK: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range test.headers {
+				h.Set(k, v)
+			}
 
-	outputsJSON := `{"another_prop":"output value"}`
-	var requestCount atomic.Int32
+			remaining, reset, ok := parseRateLimitHeaders(h, now)
+			assert.Equal(t, test.expectedOK, ok)
+			assert.Equal(t, test.expectedRemaining, remaining)
+			assert.Equal(t, test.expectedReset, reset)
+		})
+	}
+}
 
-	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		count := requestCount.Add(1)
-		if r.URL.Path == fakeResourceURLPath {
-			if count == 1 {
-				// Return 429 on the first request with Retry-After: 0
-				w.Header().Set("Retry-After", "0")
-				w.WriteHeader(http.StatusTooManyRequests)
-				_, _ = io.WriteString(w, `{"message":"rate limited"}`)
-				return
-			}
-			// Return success on subsequent requests
-			_, err := io.WriteString(w, outputsJSON)
-			if err != nil {
-				t.Errorf("Error writing string to the response stream: %v", err)
-			}
-			return
-		}
+func TestRateLimitTransportPacesRequests(t *testing.T) {
+	ctx := context.Background()
 
-		_, err := io.WriteString(w, "Unknown path")
-		if err != nil {
-			t.Errorf("Error writing string to the response stream: %v", err)
-		}
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `{"another_prop":"output value"}`)
 	}))
-	testServer.EnableHTTP2 = true
-	testServer.Start()
 	defer testServer.Close()
 
-	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	p := makeTestGenericProviderWithOpts(ctx, t, testServer, nil, true, WithRateLimits(
+		RateLimitRule{Method: http.MethodGet, RequestsPerSecond: 20},
+		// Doesn't apply to the GET requests.
+		RateLimitRule{Method: http.MethodPost, RequestsPerSecond: 0.001},
+	))
 
-	readResp, err := p.Read(ctx, &pulumirpc.ReadRequest{
-		Id:         "/fake-id",
-		Inputs:     nil,
-		Properties: nil,
-		Urn:        "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
-	})
+	start := time.Now()
+	for range 5 {
+		_, err := readFakeResource(ctx, t, p)
+		require.NoError(t, err)
+	}
 
-	require.NoError(t, err)
-	assert.NotNil(t, readResp)
-	// The transport should have retried: total requests = 2
-	assert.Equal(t, int32(2), requestCount.Load(), "Expected 2 requests: one 429 and one successful retry")
-	assert.Contains(t, readResp.GetProperties().AsMap(), "anotherProp")
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+	assert.Less(t, time.Since(start), 10*time.Second)
 }
 
-// TestRateLimitTransportNoRetryWithoutRetryAfterHeader verifies that when a
-// 429 response is received without a Retry-After header, the 429 is returned
-// to the caller without retrying.
-func TestRateLimitTransportNoRetryWithoutRetryAfterHeader(t *testing.T) {
+func TestRateLimitTransportRefundsCanceledRequests(t *testing.T) {
 	ctx := context.Background()
 
-	var requestCount atomic.Int32
-
-	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestCount.Add(1)
-		if r.URL.Path == fakeResourceURLPath {
-			w.WriteHeader(http.StatusTooManyRequests)
-			_, _ = io.WriteString(w, `{"message":"rate limited"}`)
-			return
+	var sent atomic.Int32
+	transport := newRateLimitTransport(roundTripperFunc(func(_ *http.Request) (*http.Response, error) {
+		sent.Add(1)
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody}, nil
+	}), []RateLimitRule{{RequestsPerSecond: 1}})
+
+	send := func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.example.com/things", nil)
+		require.NoError(t, err)
+		resp, err := transport.RoundTrip(req)
+		if err == nil {
+			resp.Body.Close()
 		}
-
-		_, err := io.WriteString(w, "Unknown path")
-		if err != nil {
-			t.Errorf("Error writing string to the response stream: %v", err)
-		}
-	}))
-	testServer.EnableHTTP2 = true
-	testServer.Start()
-	defer testServer.Close()
-
-	p := makeTestGenericProvider(ctx, t, testServer, nil)
-
-	readResp, err := p.Read(ctx, &pulumirpc.ReadRequest{
-		Id:         "/fake-id",
-		Inputs:     nil,
-		Properties: nil,
-		Urn:        "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
-	})
-
-	assert.Error(t, err, "Expected an error when 429 has no Retry-After header")
-	assert.Nil(t, readResp)
-	// Only one request should have been made (no retry)
-	assert.Equal(t, int32(1), requestCount.Load(), "Expected exactly 1 request with no retry")
+		return err
+	}
+
+	require.NoError(t, send(ctx))
+
+	// The requests are canceled while they wait for a token.
+	for range 3 {
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		err := send(timeoutCtx)
+		cancel()
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+	assert.Equal(t, int32(1), sent.Load())
+
+	// The next request only waits for the token of the first one.
+	transport.mu.Lock()
+	wait := transport.getBuckets(&http.Request{Method: http.MethodGet, URL: &url.URL{Host: "api.example.com"}}, time.Now())[0].reserve(time.Now())
+	transport.mu.Unlock()
+	assert.LessOrEqual(t, wait, time.Second)
 }
 
-// TestRateLimitTransportNoRetryWithNegativeRetryAfter verifies that when a
-// 429 response includes a negative Retry-After value, the 429 is returned to
-// the caller without retrying.
-func TestRateLimitTransportNoRetryWithNegativeRetryAfter(t *testing.T) {
+func TestRateLimitTransportAdaptsToResponseHeaders(t *testing.T) {
 	ctx := context.Background()
 
 	var requestCount atomic.Int32
-
-	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestCount.Add(1)
-		if r.URL.Path == fakeResourceURLPath {
-			w.Header().Set("Retry-After", "-1")
-			w.WriteHeader(http.StatusTooManyRequests)
-			_, _ = io.WriteString(w, `{"message":"rate limited"}`)
-			return
-		}
-
-		_, err := io.WriteString(w, "Unknown path")
-		if err != nil {
-			t.Errorf("Error writing string to the response stream: %v", err)
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if requestCount.Add(1) == 1 {
+			w.Header().Set(headerRateLimitRemaining, "0")
+			w.Header().Set(headerRateLimitReset, "0.3")
 		}
+		_, _ = io.WriteString(w, `{"another_prop":"output value"}`)
 	}))
-	testServer.EnableHTTP2 = true
-	testServer.Start()
 	defer testServer.Close()
 
-	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	p := makeTestGenericProviderWithOpts(ctx, t, testServer, nil, true, WithRateLimits(
+		RateLimitRule{RequestsPerSecond: 1000, Burst: 10},
+	))
 
-	readResp, err := p.Read(ctx, &pulumirpc.ReadRequest{
-		Id:         "/fake-id",
-		Inputs:     nil,
-		Properties: nil,
-		Urn:        "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
-	})
+	_, err := readFakeResource(ctx, t, p)
+	require.NoError(t, err)
 
-	assert.Error(t, err, "Expected an error when Retry-After is negative")
-	assert.Nil(t, readResp)
-	assert.Equal(t, int32(1), requestCount.Load(), "Expected exactly 1 request with no retry")
+	start := time.Now()
+	_, err = readFakeResource(ctx, t, p)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 250*time.Millisecond)
 }
 
-// TestRateLimitTransportNoRetryWithNonIntegerRetryAfter verifies that when a
-// 429 response includes a non-integer Retry-After value (e.g., an HTTP-date),
-// the 429 is returned to the caller without retrying.
-func TestRateLimitTransportNoRetryWithNonIntegerRetryAfter(t *testing.T) {
+func TestRateLimitsFromProviderConfig(t *testing.T) {
 	ctx := context.Background()
 
-	var requestCount atomic.Int32
-
-	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestCount.Add(1)
-		if r.URL.Path == fakeResourceURLPath {
-			w.Header().Set("Retry-After", "Wed, 21 Oct 2015 07:28:00 GMT")
-			w.WriteHeader(http.StatusTooManyRequests)
-			_, _ = io.WriteString(w, `{"message":"rate limited"}`)
-			return
-		}
-
-		_, err := io.WriteString(w, "Unknown path")
-		if err != nil {
-			t.Errorf("Error writing string to the response stream: %v", err)
-		}
-	}))
-	testServer.EnableHTTP2 = true
-	testServer.Start()
+	testServer := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
 	defer testServer.Close()
 
-	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	p := makeTestGenericProvider(ctx, t, testServer, nil).(*Provider)
+	assert.Empty(t, p.rateLimitTransport.rules)
 
-	readResp, err := p.Read(ctx, &pulumirpc.ReadRequest{
-		Id:         "/fake-id",
-		Inputs:     nil,
-		Properties: nil,
-		Urn:        "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
+	_, err := p.Configure(ctx, &pulumirpc.ConfigureRequest{
+		Variables: map[string]string{
+			"generic:config:rateLimits": `[{"host":"api.example.com","method":"POST","requestsPerSecond":2,"burst":5}]`,
+		},
 	})
+	require.NoError(t, err)
+	assert.Equal(t, []RateLimitRule{{Host: "api.example.com", Method: http.MethodPost, RequestsPerSecond: 2, Burst: 5}}, p.rateLimitTransport.rules)
 
-	assert.Error(t, err, "Expected an error when Retry-After is an HTTP-date")
-	assert.Nil(t, readResp)
-	assert.Equal(t, int32(1), requestCount.Load(), "Expected exactly 1 request with no retry")
+	_, err = p.Configure(ctx, &pulumirpc.ConfigureRequest{
+		Variables: map[string]string{"generic:config:rateLimits": `[{"requestsPerSecond":0}]`},
+	})
+	assert.Error(t, err)
 }
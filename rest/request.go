@@ -15,7 +15,6 @@ import (
 
 	"github.com/cloudy-sky-software/pulumi-provider-framework/state"
 
-	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/getkin/kin-openapi/openapi3filter"
 
 	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
@@ -45,56 +44,17 @@ type Request interface {
 	CreatePutRequest(ctx context.Context, httpEndpointPath string, reqBody []byte, inputs resource.PropertyMap) (*http.Request, error)
 }
 
-func (p *Provider) getAuthHeaderName() string {
-	var authHeaderName string
-
-	// We are assuming that the API requires auth as a header attribute.
-	for _, securitySchemeRef := range p.openAPIDoc.Components.SecuritySchemes {
-		switch {
-		case securitySchemeRef.Value.Name != "":
-			authHeaderName = securitySchemeRef.Value.Name
-		case securitySchemeRef.Value.Scheme == "bearer":
-			fallthrough
-		default:
-			authHeaderName = "Authorization"
-		}
-		break
-	}
-
-	return authHeaderName
-}
-
-func (p *Provider) getSupportedAuthSchemes() []string {
-	schemes := make([]string, 0, len(p.openAPIDoc.Components.SecuritySchemes))
-
-	for _, securitySchemeRef := range p.openAPIDoc.Components.SecuritySchemes {
-		scheme := newTitleCaser().String(securitySchemeRef.Value.Scheme)
-		if scheme == "" && strings.ToLower(securitySchemeRef.Value.Type) == "oauth2" {
-			scheme = "Bearer"
-		}
-
-		if scheme == "" {
-			continue
-		}
-
-		schemes = append(schemes, scheme)
-	}
-
-	return schemes
-}
-
 // CreateGetRequest returns a validated GET HTTP request for the provided inputs map.
 func (p *Provider) CreateGetRequest(
 	ctx context.Context,
 	httpEndpointPath string,
 	inputs resource.PropertyMap,
 	currentState *resource.PropertyMap) (*http.Request, error) {
-	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+httpEndpointPath, nil)
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.getServerURL(httpEndpointPath, http.MethodGet)+httpEndpointPath, nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "initializing request")
 	}
 
-	httpReq.Header.Add(p.getAuthHeaderName(), p.providerCallback.GetAuthorizationHeader())
 	httpReq.Header.Add("Accept", jsonMimeType)
 	httpReq.Header.Add("Content-Type", jsonMimeType)
 
@@ -115,6 +75,16 @@ func (p *Provider) CreateGetRequest(
 		}
 	}
 
+	params, err := p.getRequestParams(httpEndpointPath, http.MethodGet, inputs)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting request params")
+	}
+	params.apply(httpReq)
+
+	if err := p.authenticate(ctx, httpReq, p.getSecurityRequirements(httpEndpointPath, http.MethodGet)); err != nil {
+		return nil, err
+	}
+
 	if err := p.validateRequest(ctx, httpReq, pathParams); err != nil {
 		return nil, errors.Wrap(err, "validate http request")
 	}
@@ -123,6 +93,10 @@ func (p *Provider) CreateGetRequest(
 		return nil, errors.Wrap(err, "replacing path params")
 	}
 
+	if err := p.signRequest(httpReq); err != nil {
+		return nil, err
+	}
+
 	return httpReq, nil
 }
 
@@ -158,6 +132,14 @@ func (p *Provider) createHTTPRequestWithBody(ctx context.Context, httpEndpointPa
 		}
 	}
 
+	params, err := p.getRequestParams(httpEndpointPath, httpMethod, inputs)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting request params")
+	}
+	if bodyMap != nil {
+		params.removeFromRequestBody(bodyMap)
+	}
+
 	var buf io.Reader
 	// Transform properties in the request body from SDK name to API name.
 	if bodyMap != nil {
@@ -171,16 +153,20 @@ func (p *Provider) createHTTPRequestWithBody(ctx context.Context, httpEndpointPa
 		buf = bytes.NewBuffer(updatedBody)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, httpMethod, p.baseURL+httpEndpointPath, buf)
+	httpReq, err := http.NewRequestWithContext(ctx, httpMethod, p.getServerURL(httpEndpointPath, httpMethod)+httpEndpointPath, buf)
 	if err != nil {
 		return nil, errors.Wrap(err, "initializing request")
 	}
 
-	logging.V(3).Infof("URL: %s", httpReq.URL.String())
-
-	httpReq.Header.Add(p.getAuthHeaderName(), p.providerCallback.GetAuthorizationHeader())
 	httpReq.Header.Add("Accept", jsonMimeType)
 	httpReq.Header.Add("Content-Type", jsonMimeType)
+	params.apply(httpReq)
+
+	if err := p.authenticate(ctx, httpReq, p.getSecurityRequirements(httpEndpointPath, httpMethod)); err != nil {
+		return nil, err
+	}
+
+	logging.V(3).Infof("URL: %s", redactURL(httpReq.URL))
 
 	if err := p.validateRequest(ctx, httpReq, pathParams); err != nil {
 		return nil, errors.Wrap(err, "validate http request")
@@ -190,6 +176,10 @@ func (p *Provider) createHTTPRequestWithBody(ctx context.Context, httpEndpointPa
 		return nil, errors.Wrap(err, "replacing path params")
 	}
 
+	if err := p.signRequest(httpReq); err != nil {
+		return nil, err
+	}
+
 	return httpReq, nil
 }
 
@@ -218,7 +208,7 @@ func (p *Provider) CreateDeleteRequest(ctx context.Context, httpEndpointPath str
 }
 
 func (p *Provider) validateRequest(ctx context.Context, httpReq *http.Request, pathParams map[string]string) error {
-	route, _, err := p.router.FindRoute(httpReq)
+	route, _, err := p.config().router.FindRoute(httpReq)
 	if err != nil {
 		return errors.Wrap(err, "finding route from router")
 	}
@@ -230,34 +220,7 @@ func (p *Provider) validateRequest(ctx context.Context, httpReq *http.Request, p
 		Route:      route,
 		Options: &openapi3filter.Options{
 			AuthenticationFunc: func(_ context.Context, ai *openapi3filter.AuthenticationInput) error {
-				authHeaderName := p.getAuthHeaderName()
-				authHeaderValue := ai.RequestValidationInput.Request.Header.Get(authHeaderName)
-				if authHeaderValue == "" {
-					return errors.Errorf("authorization header %s is required", authHeaderName)
-				}
-
-				authSchemes := p.getSupportedAuthSchemes()
-				if len(authSchemes) == 0 {
-					return nil
-				}
-
-				matchingAuthSchemePrefix := ""
-				for _, scheme := range authSchemes {
-					if strings.HasPrefix(authHeaderValue, scheme) {
-						matchingAuthSchemePrefix = scheme
-						break
-					}
-				}
-				if matchingAuthSchemePrefix == "" {
-					return errors.Errorf("unexpected auth scheme (expected one of %v)", authSchemes)
-				}
-
-				token := strings.TrimPrefix(authHeaderValue, fmt.Sprintf("%s ", bearerAuthSchemePrefix))
-				if token == "" {
-					return errors.New("auth token is required")
-				}
-
-				return nil
+				return validateSecurityScheme(ai.RequestValidationInput.Request, ai.SecurityScheme)
 			},
 		},
 	}
@@ -281,6 +244,9 @@ func (p *Provider) validateRequest(ctx context.Context, httpReq *http.Request, p
 	httpReq.ContentLength = newContentLength
 	logging.V(3).Infof("UPDATED REQUEST BODY: %v", string(clonedBody))
 	httpReq.Body = io.NopCloser(bytes.NewBuffer(clonedBody))
+	httpReq.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(clonedBody)), nil
+	}
 
 	return nil
 }
@@ -288,22 +254,7 @@ func (p *Provider) validateRequest(ctx context.Context, httpReq *http.Request, p
 func (p *Provider) getPathParamsMap(apiPath, requestMethod string, properties resource.PropertyMap, oldInputs ...resource.PropertyMap) (map[string]string, error) {
 	pathParams := make(map[string]string)
 
-	parameters := p.openAPIDoc.Paths.Find(apiPath).Parameters
-
-	switch requestMethod {
-	case http.MethodGet:
-		parameters = append(parameters, p.openAPIDoc.Paths.Find(apiPath).Get.Parameters...)
-	case http.MethodPost:
-		parameters = append(parameters, p.openAPIDoc.Paths.Find(apiPath).Post.Parameters...)
-	case http.MethodPatch:
-		parameters = append(parameters, p.openAPIDoc.Paths.Find(apiPath).Patch.Parameters...)
-	case http.MethodPut:
-		parameters = append(parameters, p.openAPIDoc.Paths.Find(apiPath).Put.Parameters...)
-	case http.MethodDelete:
-		parameters = append(parameters, p.openAPIDoc.Paths.Find(apiPath).Delete.Parameters...)
-	default:
-		return pathParams, nil
-	}
+	parameters := p.getOperationParams(apiPath, requestMethod)
 
 	var resolvedOldInputs resource.PropertyMap
 	if len(oldInputs) > 0 && oldInputs[0] != nil {
@@ -315,7 +266,7 @@ func (p *Provider) getPathParamsMap(apiPath, requestMethod string, properties re
 	logging.V(3).Infof("Process path parameters with %v", properties)
 	count := 0
 	for _, param := range parameters {
-		if param.Value.In != "path" {
+		if param.Value.In != parameterLocationPath {
 			continue
 		}
 
@@ -348,13 +299,13 @@ func (p *Provider) getPathParamsMap(apiPath, requestMethod string, properties re
 		// we have the old inputs, if we are dealing with the state
 		// of an existing resource.
 		if !ok {
-			logging.V(3).Infof("Global Params Map: %v, sdkName: %s", p.globalPathParams, sdkName)
+			logging.V(3).Infof("Global Params Map: %v, sdkName: %s", p.config().globalPathParams, sdkName)
 			// Try to see if a top-level property has the required prop perhaps.
 			_, topLevelPropName, ok := tryPluckingProp(sdkName, properties.Mappable())
 			if ok {
 				topLevelProp := properties[resource.PropertyKey(topLevelPropName)]
 				property = topLevelProp.ObjectValue()[resource.PropertyKey(sdkName)]
-			} else if globalPathParam, ok := p.globalPathParams[sdkName]; ok {
+			} else if globalPathParam, ok := p.config().globalPathParams[sdkName]; ok {
 				// Is the property a global path param set in the provider?
 				// We look for this after checking the resource state, so it can be overridden at a resource level
 				logging.V(3).Infof("Path param %q is a global path param with value %q", sdkName, globalPathParam)
@@ -417,66 +368,11 @@ func (p *Provider) replacePathParams(httpReq *http.Request, pathParams map[strin
 	}
 
 	httpReq.URL.Path = path
-	logging.V(3).Infof("replacePathParams: UPDATED HTTP REQUEST URL: %s", httpReq.URL.String())
+	logging.V(3).Infof("replacePathParams: UPDATED HTTP REQUEST URL: %s", redactURL(httpReq.URL))
 
 	return nil
 }
 
-func (p *Provider) determineDiffsAndReplacements(d *resource.ObjectDiff, schemaRef openapi3.SchemaRef) ([]string, []string) {
-	replaces := make([]string, 0)
-	diffs := make([]string, 0)
-
-	apiNameLookupMap := p.metadata.SDKToAPINameMap
-
-	var properties openapi3.Schemas
-	if len(schemaRef.Value.Properties) > 0 {
-		properties = schemaRef.Value.Properties
-	} else if len(schemaRef.Value.AllOf) > 0 {
-		properties = make(openapi3.Schemas, 0)
-		for _, schemaRef := range schemaRef.Value.AllOf {
-			for k, v := range schemaRef.Value.Properties {
-				properties[k] = v
-			}
-		}
-	}
-
-	for propKey := range d.Adds {
-		prop := string(propKey)
-		// If the added property is not part of the PATCH operation schema,
-		// then suggest a replacement triggered by this property.
-
-		if _, ok := properties[getOrKey(apiNameLookupMap, prop)]; !ok {
-			replaces = append(replaces, prop)
-		} else {
-			diffs = append(diffs, prop)
-		}
-	}
-
-	for propKey := range d.Updates {
-		prop := string(propKey)
-		// If the updated property is not part of the PATCH operation schema,
-		// then suggest a replacement triggered by this property.
-		if _, ok := properties[getOrKey(apiNameLookupMap, prop)]; !ok {
-			replaces = append(replaces, prop)
-		} else {
-			diffs = append(diffs, prop)
-		}
-	}
-
-	for propKey := range d.Deletes {
-		prop := string(propKey)
-		// If the deleted property is not part of the PATCH operation schema,
-		// then suggest a replacement triggered by this property.
-		if _, ok := properties[getOrKey(apiNameLookupMap, prop)]; !ok {
-			replaces = append(replaces, prop)
-		} else {
-			diffs = append(diffs, prop)
-		}
-	}
-
-	return replaces, diffs
-}
-
 func (p *Provider) mapImportIDToPathParams(id, httpEndpointPath string) (map[string]interface{}, error) {
 	pathParams := make([]string, 0)
 	idParts := strings.Split(strings.TrimPrefix(id, "/"), "/")
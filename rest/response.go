@@ -1,13 +1,89 @@
 package rest
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/pulumi/pulumi/sdk/v3/go/common/util/logging"
 )
 
 var validStatusCodesForDelete = []int{http.StatusOK, http.StatusNoContent, http.StatusAccepted}
 
+// alreadyDeletedStatusCodes are the status codes of a delete request
+// that indicate that the resource was already deleted.
+var alreadyDeletedStatusCodes = []int{http.StatusNotFound, http.StatusGone}
+
+// NotFoundHint declares the responses of a resource's read endpoint
+// that indicate that the resource no longer exists. A 404 always
+// indicates that.
+type NotFoundHint struct {
+	// StatusCodes are additional status codes, such as 410, that
+	// indicate that the resource no longer exists.
+	StatusCodes []int `json:"statusCodes,omitempty"`
+	// BodyProperty is a property in the response body whose value
+	// indicates whether the resource no longer exists. Nested properties
+	// can be separated by a `.`.
+	BodyProperty string `json:"bodyProperty,omitempty"`
+	// BodyValues are the values of BodyProperty that indicate that the
+	// resource no longer exists, such as `true` for a `deleted` property.
+	BodyValues []string `json:"bodyValues,omitempty"`
+}
+
+// isResourceNotFoundFunc returns isResourceNotFound for a resource type.
+func (p *Provider) isResourceNotFoundFunc(resourceTypeToken string) func(statusCode int, body []byte) bool {
+	return func(statusCode int, body []byte) bool {
+		return p.isResourceNotFound(resourceTypeToken, statusCode, body)
+	}
+}
+
+// isResourceNotFound returns true if the response of a resource's read
+// endpoint indicates that the resource no longer exists.
+func (p *Provider) isResourceNotFound(resourceTypeToken string, statusCode int, body []byte) bool {
+	if statusCode == http.StatusNotFound {
+		return true
+	}
+
+	hint, ok := p.frameworkMetadata.NotFoundMap[resourceTypeToken]
+	if !ok {
+		return false
+	}
+
+	if slices.Contains(hint.StatusCodes, statusCode) {
+		return true
+	}
+
+	if hint.BodyProperty == "" || len(hint.BodyValues) == 0 {
+		return false
+	}
+
+	var bodyMap map[string]interface{}
+	if err := json.Unmarshal(body, &bodyMap); err != nil {
+		return false
+	}
+
+	v, ok := lookupJSONPointer(bodyMap, "/"+strings.ReplaceAll(hint.BodyProperty, ".", "/"))
+	if !ok || v == nil {
+		return false
+	}
+
+	return slices.Contains(hint.BodyValues, fmt.Sprintf("%v", v))
+}
+
+// getResourceID returns the id of a resource from its top-level
+// properties or else from one of the properties that embed it.
+func getResourceID(outputsMap map[string]interface{}) (interface{}, bool) {
+	if id, ok := outputsMap["id"]; ok {
+		return id, true
+	}
+
+	logging.V(3).Infof("id prop not found in top-level response. Checking if an embedded property has it...")
+	id, _, ok := tryPluckingProp("id", outputsMap)
+	return id, ok
+}
+
 // tryPluckingProp does a shallow search for a prop in a map.
 // In other words, this only looks for the prop in top-level
 // properties and does not go deeper than that.
@@ -0,0 +1,317 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/logging"
+)
+
+const (
+	headerIdempotencyKey = "Idempotency-Key"
+
+	// minThrottledRetryDelay is the minimum delay before an HTTP 429
+	// response is retried, so that a `Retry-After: 0` doesn't retry the
+	// request in a tight loop.
+	minThrottledRetryDelay = 100 * time.Millisecond
+)
+
+// RetryPolicy controls how requests that fail with a transient error
+// are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts for a request,
+	// including the first one. A value of 1 disables retries. HTTP 429
+	// responses with a Retry-After header don't count towards it.
+	MaxAttempts int
+	// MaxElapsedTime is the maximum total time spent on a request
+	// across all of its attempts, including the retries of HTTP 429
+	// responses. A value of 0 means no limit.
+	MaxElapsedTime time.Duration
+
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts.
+	MaxBackoff time.Duration
+	// Multiplier is the factor by which the delay grows after
+	// each attempt.
+	Multiplier float64
+	// Jitter is the fraction, between 0 and 1, of each delay that is
+	// randomized to avoid many clients retrying at the same time.
+	Jitter float64
+
+	// RetryableStatusCodes are the response status codes that are
+	// retried. HTTP 429 responses are always retried when they
+	// include a Retry-After header.
+	RetryableStatusCodes []int
+	// IdempotencyKeyHeader is the request header that marks a
+	// non-idempotent request, such as a POST, as safe to retry.
+	IdempotencyKeyHeader string
+}
+
+// DefaultRetryPolicy returns the retry policy used by providers unless
+// it is overridden.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		MaxElapsedTime: 5 * time.Minute,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryableStatusCodes: []int{
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		IdempotencyKeyHeader: headerIdempotencyKey,
+	}
+}
+
+// backoff returns the delay before the retry that follows the given
+// attempt. Attempts are numbered from 1.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		jitter := min(p.Jitter, 1)
+		// Jitter doesn't need a cryptographically secure random number.
+		delay -= delay * jitter * rand.Float64() //nolint:gosec
+	}
+
+	return time.Duration(delay)
+}
+
+// isRetryable returns true if the request can safely be sent again.
+// Idempotent methods are always retryable, other methods only if the
+// request carries an idempotency key.
+func (p RetryPolicy) isRetryable(req *http.Request) bool {
+	if !canResendBody(req) {
+		return false
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return p.IdempotencyKeyHeader != "" && req.Header.Get(p.IdempotencyKeyHeader) != ""
+}
+
+// retryTransport is an http.RoundTripper that retries requests that fail
+// with a transient error according to a RetryPolicy.
+//
+// HTTP 429 Too Many Requests responses are retried after the delay in the
+// Retry-After header, which can be a number of seconds or an HTTP-date.
+// If the header is absent or invalid, the 429 response is returned to the
+// caller as-is. Since the API tells when the request can succeed, these
+// retries are not limited by the policy's MaxAttempts, but they are by its
+// MaxElapsedTime. Responses with one of the policy's retryable status codes,
+// connection resets and timeouts are retried with exponential backoff, but
+// only if the request is safe to send again.
+type retryTransport struct {
+	wrapped http.RoundTripper
+
+	// mu guards policy since it can be changed when the provider is
+	// configured while requests are in flight.
+	mu     sync.RWMutex
+	policy RetryPolicy
+}
+
+func (t *retryTransport) getPolicy() RetryPolicy {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.policy
+}
+
+func (t *retryTransport) setPolicy(policy RetryPolicy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.policy = policy
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	ctx := req.Context()
+	// Every attempt of a request uses the same policy.
+	policy := t.getPolicy()
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.wrapped.RoundTrip(req)
+
+		delay, retry := policy.shouldRetry(req, resp, err, attempt)
+		if retry && policy.MaxElapsedTime > 0 && time.Since(start)+delay > policy.MaxElapsedTime {
+			logging.V(3).Infof("Not retrying %s %s since the retry policy's maximum elapsed time would be exceeded", req.Method, redactURL(req.URL))
+			retry = false
+		}
+		if !retry {
+			return resp, err
+		}
+
+		if err != nil {
+			logging.V(3).Infof("Request %s %s failed with a transient error (attempt %d): %v. Retrying after %v...", req.Method, redactURL(req.URL), attempt, err, delay)
+		} else {
+			logging.V(3).Infof("Received %d response for %s %s (attempt %d). Retrying after %v...", resp.StatusCode, req.Method, redactURL(req.URL), attempt, delay)
+			// Drain the body so that the connection can be reused.
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		// Reset the request body for the retry if possible.
+		if req.GetBody != nil {
+			req.Body, err = req.GetBody()
+			if err != nil {
+				return nil, errors.Wrap(err, "resetting request body for retry")
+			}
+		}
+	}
+}
+
+// shouldRetry returns whether the request should be retried after the
+// given attempt, and the delay before the retry.
+func (p RetryPolicy) shouldRetry(req *http.Request, resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if req.Context().Err() != nil {
+		return 0, false
+	}
+
+	if err != nil {
+		if attempt >= p.MaxAttempts || !isTransientNetworkError(err) || !p.isRetryable(req) {
+			return 0, false
+		}
+
+		return p.backoff(attempt), true
+	}
+
+	retryAfter, hasRetryAfter := parseRetryAfter(resp.Header.Get(headerRetryAfter), time.Now())
+
+	// A 429 response means that the request was not processed so it is
+	// safe to retry regardless of the method, but only if the server
+	// told us when to do so.
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return max(retryAfter, minThrottledRetryDelay), hasRetryAfter && canResendBody(req)
+	}
+
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	if !slices.Contains(p.RetryableStatusCodes, resp.StatusCode) || !p.isRetryable(req) {
+		return 0, false
+	}
+
+	if hasRetryAfter {
+		return retryAfter, true
+	}
+
+	return p.backoff(attempt), true
+}
+
+// configureRetryPolicy sets the retry policy of the provider config to
+// the current one overridden with the values set in the provider config.
+// To set via pulumi config, these are "providername:retryMaxAttempts" and
+// "providername:retryMaxElapsedTime", the latter being a duration such
+// as "10m".
+func (p *Provider) configureRetryPolicy(vars map[string]string, cfg *providerConfig) error {
+	if p.retryTransport == nil {
+		return nil
+	}
+
+	policy := p.retryTransport.getPolicy()
+
+	if v, ok := vars[fmt.Sprintf("%s:config:retryMaxAttempts", p.name)]; ok {
+		maxAttempts, err := strconv.Atoi(v)
+		if err != nil || maxAttempts < 1 {
+			return errors.Errorf("invalid value for retryMaxAttempts %q: must be a positive integer", v)
+		}
+		policy.MaxAttempts = maxAttempts
+	}
+
+	if v, ok := vars[fmt.Sprintf("%s:config:retryMaxElapsedTime", p.name)]; ok {
+		maxElapsedTime, err := time.ParseDuration(v)
+		if err != nil || maxElapsedTime < 0 {
+			return errors.Errorf("invalid value for retryMaxElapsedTime %q: must be a non-negative duration", v)
+		}
+		policy.MaxElapsedTime = maxElapsedTime
+	}
+
+	cfg.retryPolicy = &policy
+
+	logging.V(3).Infof("Retry policy: maxAttempts: %d, maxElapsedTime: %v", policy.MaxAttempts, policy.MaxElapsedTime)
+	return nil
+}
+
+// canResendBody returns true if the request has no body or if its body
+// can be reset for another attempt.
+func canResendBody(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// isTransientNetworkError returns true if err is a network error that is
+// likely to succeed if the request is sent again.
+func isTransientNetworkError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// parseRetryAfter returns the delay indicated by the value of a
+// Retry-After header, which is either a non-negative number of seconds
+// or an HTTP-date.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(v); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+
+	return max(date.Sub(now), 0), true
+}
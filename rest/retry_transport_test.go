@@ -0,0 +1,442 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+)
+
+const fakeResourceURLPath = "/v2/fakeresource/fake-id"
+
+// TestRateLimitTransportRetryWithRetryAfterInteger verifies that when a 429
+// response is received with a valid non-negative integer Retry-After header,
+// the request is retried and ultimately succeeds.
+func TestRateLimitTransportRetryWithRetryAfterInteger(t *testing.T) {
+	ctx := context.Background()
+
+	outputsJSON := `{"another_prop":"output value"}`
+	var requestCount atomic.Int32
+
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count := requestCount.Add(1)
+		if r.URL.Path == fakeResourceURLPath {
+			if count == 1 {
+				// Return 429 on the first request with Retry-After: 0
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = io.WriteString(w, `{"message":"rate limited"}`)
+				return
+			}
+			// Return success on subsequent requests
+			_, err := io.WriteString(w, outputsJSON)
+			if err != nil {
+				t.Errorf("Error writing string to the response stream: %v", err)
+			}
+			return
+		}
+
+		_, err := io.WriteString(w, "Unknown path")
+		if err != nil {
+			t.Errorf("Error writing string to the response stream: %v", err)
+		}
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+
+	readResp, err := p.Read(ctx, &pulumirpc.ReadRequest{
+		Id:         "/fake-id",
+		Inputs:     nil,
+		Properties: nil,
+		Urn:        "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
+	})
+
+	require.NoError(t, err)
+	assert.NotNil(t, readResp)
+	// The transport should have retried: total requests = 2
+	assert.Equal(t, int32(2), requestCount.Load(), "Expected 2 requests: one 429 and one successful retry")
+	assert.Contains(t, readResp.GetProperties().AsMap(), "anotherProp")
+}
+
+// TestRateLimitTransportNoRetryWithoutRetryAfterHeader verifies that when a
+// 429 response is received without a Retry-After header, the 429 is returned
+// to the caller without retrying.
+func TestRateLimitTransportNoRetryWithoutRetryAfterHeader(t *testing.T) {
+	ctx := context.Background()
+
+	var requestCount atomic.Int32
+
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount.Add(1)
+		if r.URL.Path == fakeResourceURLPath {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = io.WriteString(w, `{"message":"rate limited"}`)
+			return
+		}
+
+		_, err := io.WriteString(w, "Unknown path")
+		if err != nil {
+			t.Errorf("Error writing string to the response stream: %v", err)
+		}
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+
+	readResp, err := p.Read(ctx, &pulumirpc.ReadRequest{
+		Id:         "/fake-id",
+		Inputs:     nil,
+		Properties: nil,
+		Urn:        "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
+	})
+
+	assert.Error(t, err, "Expected an error when 429 has no Retry-After header")
+	assert.Nil(t, readResp)
+	// Only one request should have been made (no retry)
+	assert.Equal(t, int32(1), requestCount.Load(), "Expected exactly 1 request with no retry")
+}
+
+// TestRateLimitTransportNoRetryWithNegativeRetryAfter verifies that when a
+// 429 response includes a negative Retry-After value, the 429 is returned to
+// the caller without retrying.
+func TestRateLimitTransportNoRetryWithNegativeRetryAfter(t *testing.T) {
+	ctx := context.Background()
+
+	var requestCount atomic.Int32
+
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount.Add(1)
+		if r.URL.Path == fakeResourceURLPath {
+			w.Header().Set("Retry-After", "-1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = io.WriteString(w, `{"message":"rate limited"}`)
+			return
+		}
+
+		_, err := io.WriteString(w, "Unknown path")
+		if err != nil {
+			t.Errorf("Error writing string to the response stream: %v", err)
+		}
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+
+	readResp, err := p.Read(ctx, &pulumirpc.ReadRequest{
+		Id:         "/fake-id",
+		Inputs:     nil,
+		Properties: nil,
+		Urn:        "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
+	})
+
+	assert.Error(t, err, "Expected an error when Retry-After is negative")
+	assert.Nil(t, readResp)
+	assert.Equal(t, int32(1), requestCount.Load(), "Expected exactly 1 request with no retry")
+}
+
+// TestRateLimitTransportRetryWithRetryAfterHTTPDate verifies that when a
+// 429 response includes a Retry-After value that is an HTTP-date, the
+// request is retried once that date has passed.
+func TestRateLimitTransportRetryWithRetryAfterHTTPDate(t *testing.T) {
+	ctx := context.Background()
+
+	var requestCount atomic.Int32
+
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count := requestCount.Add(1)
+		if r.URL.Path == fakeResourceURLPath {
+			if count == 1 {
+				w.Header().Set("Retry-After", "Wed, 21 Oct 2015 07:28:00 GMT")
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = io.WriteString(w, `{"message":"rate limited"}`)
+				return
+			}
+			_, _ = io.WriteString(w, `{"another_prop":"output value"}`)
+			return
+		}
+
+		_, err := io.WriteString(w, "Unknown path")
+		if err != nil {
+			t.Errorf("Error writing string to the response stream: %v", err)
+		}
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+
+	readResp, err := p.Read(ctx, &pulumirpc.ReadRequest{
+		Id:         "/fake-id",
+		Inputs:     nil,
+		Properties: nil,
+		Urn:        "urn:pulumi:some-stack::some-project::generic:fakeresource/v2:FakeResource::myResource",
+	})
+
+	require.NoError(t, err)
+	assert.NotNil(t, readResp)
+	assert.Equal(t, int32(2), requestCount.Load(), "Expected 2 requests: one 429 and one successful retry")
+}
+
+func makeTestRetryProvider(ctx context.Context, t *testing.T, testServer *httptest.Server) *Provider {
+	t.Helper()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil).(*Provider)
+	p.retryTransport.policy.InitialBackoff = time.Millisecond
+	p.retryTransport.policy.MaxBackoff = 5 * time.Millisecond
+
+	return p
+}
+
+func TestRetryTransportRetriesTransientServerErrors(t *testing.T) {
+	ctx := context.Background()
+
+	var requestCount atomic.Int32
+
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		switch requestCount.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			_, _ = io.WriteString(w, `{"another_prop":"output value"}`)
+		}
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestRetryProvider(ctx, t, testServer)
+
+	readResp, err := p.Read(ctx, &pulumirpc.ReadRequest{
+		Id:  "/fake-id",
+		Urn: "urn:pulumi:some-stack::some-project::" + fakeResourceTypeToken + "::myResource",
+	})
+
+	require.NoError(t, err)
+	assert.Contains(t, readResp.GetProperties().AsMap(), "anotherProp")
+	assert.Equal(t, int32(3), requestCount.Load())
+}
+
+func TestRetryTransportStopsAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+
+	var requestCount atomic.Int32
+
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requestCount.Add(1)
+		w.WriteHeader(http.StatusGatewayTimeout)
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestRetryProvider(ctx, t, testServer)
+	p.retryTransport.policy.MaxAttempts = 3
+
+	_, err := p.Read(ctx, &pulumirpc.ReadRequest{
+		Id:  "/fake-id",
+		Urn: "urn:pulumi:some-stack::some-project::" + fakeResourceTypeToken + "::myResource",
+	})
+
+	require.Error(t, err)
+	assert.Equal(t, int32(3), requestCount.Load())
+}
+
+func TestRetryTransportRetriesThrottledRequestsBeyondMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+
+	var requestCount atomic.Int32
+
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if requestCount.Add(1) <= 7 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = io.WriteString(w, `{"another_prop":"output value"}`)
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestRetryProvider(ctx, t, testServer)
+
+	readResp, err := p.Read(ctx, &pulumirpc.ReadRequest{
+		Id:  "/fake-id",
+		Urn: "urn:pulumi:some-stack::some-project::" + fakeResourceTypeToken + "::myResource",
+	})
+
+	require.NoError(t, err)
+	assert.Contains(t, readResp.GetProperties().AsMap(), "anotherProp")
+	assert.Greater(t, requestCount.Load(), int32(p.retryTransport.policy.MaxAttempts))
+	assert.Equal(t, int32(8), requestCount.Load())
+}
+
+func TestRetryTransportStopsThrottledRetriesAfterMaxElapsedTime(t *testing.T) {
+	ctx := context.Background()
+
+	var requestCount atomic.Int32
+
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requestCount.Add(1)
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestRetryProvider(ctx, t, testServer)
+	p.retryTransport.policy.MaxElapsedTime = 350 * time.Millisecond
+
+	_, err := p.Read(ctx, &pulumirpc.ReadRequest{
+		Id:  "/fake-id",
+		Urn: "urn:pulumi:some-stack::some-project::" + fakeResourceTypeToken + "::myResource",
+	})
+
+	require.Error(t, err)
+	// The retries of `Retry-After: 0` are spaced by the minimum delay.
+	assert.LessOrEqual(t, requestCount.Load(), int32(4))
+	assert.Greater(t, requestCount.Load(), int32(1))
+}
+
+func TestRetryTransportRetriesPostOnlyWithIdempotencyKey(t *testing.T) {
+	var requestCount atomic.Int32
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"name":"test"}`, string(body))
+
+		if requestCount.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer testServer.Close()
+
+	client := &http.Client{
+		Transport: &retryTransport{
+			wrapped: http.DefaultTransport,
+			policy: RetryPolicy{
+				MaxAttempts:          3,
+				InitialBackoff:       time.Millisecond,
+				RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+				IdempotencyKeyHeader: headerIdempotencyKey,
+			},
+		},
+	}
+
+	req, err := http.NewRequest(http.MethodPost, testServer.URL, strings.NewReader(`{"name":"test"}`))
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(1), requestCount.Load(), "Expected a POST without an idempotency key to not be retried")
+
+	requestCount.Store(0)
+	req, err = http.NewRequest(http.MethodPost, testServer.URL, strings.NewReader(`{"name":"test"}`))
+	require.NoError(t, err)
+	req.Header.Set(headerIdempotencyKey, "some-key")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, int32(2), requestCount.Load())
+}
+
+func TestRetryTransportRetriesConnectionResets(t *testing.T) {
+	var requestCount atomic.Int32
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if requestCount.Add(1) == 1 {
+			// Close the connection without writing a response.
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	client := &http.Client{
+		Transport: &retryTransport{
+			wrapped: &http.Transport{DisableKeepAlives: true},
+			policy: RetryPolicy{
+				MaxAttempts:    3,
+				InitialBackoff: time.Millisecond,
+			},
+		},
+	}
+
+	resp, err := client.Get(testServer.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), requestCount.Load())
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC)
+
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{value: "", ok: false},
+		{value: "120", expected: 2 * time.Minute, ok: true},
+		{value: "-1", ok: false},
+		{value: "soon", ok: false},
+		{value: "Wed, 21 Oct 2015 07:28:30 GMT", expected: 30 * time.Second, ok: true},
+		{value: "Wed, 21 Oct 2015 07:27:00 GMT", expected: 0, ok: true},
+	}
+
+	for _, test := range tests {
+		delay, ok := parseRetryAfter(test.value, now)
+		assert.Equal(t, test.ok, ok, "Retry-After: %q", test.value)
+		assert.Equal(t, test.expected, delay, "Retry-After: %q", test.value)
+	}
+}
+
+func TestRetryPolicyFromProviderConfig(t *testing.T) {
+	ctx := context.Background()
+
+	p := makeTestGenericProvider(ctx, t, nil, nil).(*Provider)
+	assert.Equal(t, DefaultRetryPolicy().MaxAttempts, p.retryTransport.policy.MaxAttempts)
+
+	_, err := p.Configure(ctx, &pulumirpc.ConfigureRequest{
+		Variables: map[string]string{
+			"generic:config:retryMaxAttempts":    "2",
+			"generic:config:retryMaxElapsedTime": "1m",
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, p.retryTransport.policy.MaxAttempts)
+	assert.Equal(t, time.Minute, p.retryTransport.policy.MaxElapsedTime)
+
+	_, err = p.Configure(ctx, &pulumirpc.ConfigureRequest{
+		Variables: map[string]string{"generic:config:retryMaxAttempts": "zero"},
+	})
+	assert.Error(t, err)
+}
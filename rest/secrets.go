@@ -0,0 +1,149 @@
+package rest
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	pschema "github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+)
+
+// localTypeRefPrefix is the prefix of a reference to a type in the
+// provider's own Pulumi schema.
+const localTypeRefPrefix = "#/types/"
+
+// markSchemaSecrets marks the values of the properties that the Pulumi
+// schema of a resource declares as `secret` as Pulumi secrets, so that
+// they are never stored in the checkpoint in plaintext. inputs can be
+// nil if the operation does not return them.
+func (p *Provider) markSchemaSecrets(resourceTypeToken string, outputs, inputs resource.PropertyMap) {
+	resourceSpec, ok := p.schema.Resources[resourceTypeToken]
+	if !ok {
+		return
+	}
+
+	for _, path := range p.getSecretPropertyPaths(resourceSpec.Properties) {
+		markSecret(path, outputs)
+	}
+
+	if inputs == nil {
+		return
+	}
+
+	for _, path := range p.getSecretPropertyPaths(resourceSpec.InputProperties) {
+		markSecret(path, inputs)
+	}
+}
+
+// getSecretPropertyPaths returns the paths of the secret properties of
+// an object type, including the properties of nested object types.
+// Items of arrays and values of maps are denoted by a `*` segment.
+func (p *Provider) getSecretPropertyPaths(properties map[string]pschema.PropertySpec) []resource.PropertyPath {
+	var paths []resource.PropertyPath
+	p.collectSecretPropertyPaths(nil, properties, make(map[string]bool), &paths)
+
+	return paths
+}
+
+func (p *Provider) collectSecretPropertyPaths(path resource.PropertyPath, properties map[string]pschema.PropertySpec, visiting map[string]bool, paths *[]resource.PropertyPath) {
+	for _, name := range slices.Sorted(maps.Keys(properties)) {
+		propSpec := properties[name]
+		propPath := appendPath(path, name)
+		if propSpec.Secret {
+			*paths = append(*paths, propPath)
+			continue
+		}
+
+		p.collectSecretTypePaths(propPath, propSpec.TypeSpec, visiting, paths)
+	}
+}
+
+func (p *Provider) collectSecretTypePaths(path resource.PropertyPath, typeSpec pschema.TypeSpec, visiting map[string]bool, paths *[]resource.PropertyPath) {
+	switch {
+	case typeSpec.Items != nil:
+		p.collectSecretTypePaths(appendPath(path, arrayItemsPathSegment), *typeSpec.Items, visiting, paths)
+	case typeSpec.AdditionalProperties != nil:
+		p.collectSecretTypePaths(appendPath(path, arrayItemsPathSegment), *typeSpec.AdditionalProperties, visiting, paths)
+	case len(typeSpec.OneOf) > 0:
+		for _, t := range typeSpec.OneOf {
+			p.collectSecretTypePaths(path, t, visiting, paths)
+		}
+	case strings.HasPrefix(typeSpec.Ref, localTypeRefPrefix):
+		typeToken := strings.TrimPrefix(typeSpec.Ref, localTypeRefPrefix)
+		// Types can be recursive.
+		if visiting[typeToken] {
+			return
+		}
+
+		complexTypeSpec, ok := p.schema.Types[typeToken]
+		if !ok {
+			return
+		}
+
+		visiting[typeToken] = true
+		p.collectSecretPropertyPaths(path, complexTypeSpec.Properties, visiting, paths)
+		delete(visiting, typeToken)
+	}
+}
+
+// markSecret marks the value at path in a property map as a secret.
+func markSecret(path resource.PropertyPath, props resource.PropertyMap) {
+	key := resource.PropertyKey(path[0].(string))
+	value, ok := props[key]
+	if !ok || value.IsNull() {
+		return
+	}
+
+	if len(path) == 1 {
+		props[key] = makeSecret(value)
+		return
+	}
+
+	markSecretValue(path[1:], value)
+}
+
+func markSecretValue(path resource.PropertyPath, value resource.PropertyValue) {
+	value, known := unwrapPropertyValue(value)
+	if !known {
+		return
+	}
+
+	if path[0] != arrayItemsPathSegment {
+		if value.IsObject() {
+			markSecret(path, value.ObjectValue())
+		}
+		return
+	}
+
+	rest := path[1:]
+	switch {
+	case value.IsArray():
+		items := value.ArrayValue()
+		for i := range items {
+			if len(rest) == 0 {
+				items[i] = makeSecret(items[i])
+			} else {
+				markSecretValue(rest, items[i])
+			}
+		}
+	case value.IsObject():
+		obj := value.ObjectValue()
+		for k := range obj {
+			if len(rest) == 0 {
+				obj[k] = makeSecret(obj[k])
+			} else {
+				markSecretValue(rest, obj[k])
+			}
+		}
+	}
+}
+
+func makeSecret(value resource.PropertyValue) resource.PropertyValue {
+	if value.IsSecret() || value.IsNull() {
+		return value
+	}
+
+	return resource.MakeSecret(value)
+}
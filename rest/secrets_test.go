@@ -0,0 +1,75 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pschema "github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
+
+	"github.com/cloudy-sky-software/pulumi-provider-framework/state"
+)
+
+func TestSchemaSecretsAreMarkedInOutputs(t *testing.T) {
+	ctx := context.Background()
+
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `{
+			"id": "fake-id",
+			"token": "some-token",
+			"credentials": {"keyId": "key", "secretKey": "secret"},
+			"keys": [{"keyId": "key1", "secretKey": "secret1"}, {"keyId": "key2", "secretKey": "secret2"}]
+		}`)
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil).(*Provider)
+
+	const credentialsTypeToken = "generic:fakeresource/v2:Credentials"
+	p.schema.Types[credentialsTypeToken] = pschema.ComplexTypeSpec{
+		ObjectTypeSpec: pschema.ObjectTypeSpec{
+			Type: "object",
+			Properties: map[string]pschema.PropertySpec{
+				"keyId":     {TypeSpec: pschema.TypeSpec{Type: "string"}},
+				"secretKey": {TypeSpec: pschema.TypeSpec{Type: "string"}, Secret: true},
+			},
+		},
+	}
+
+	resourceSpec := p.schema.Resources[fakeResourceTypeToken]
+	resourceSpec.Properties = map[string]pschema.PropertySpec{
+		"token":       {TypeSpec: pschema.TypeSpec{Type: "string"}, Secret: true},
+		"credentials": {TypeSpec: pschema.TypeSpec{Ref: "#/types/" + credentialsTypeToken}},
+		"keys": {TypeSpec: pschema.TypeSpec{
+			Type:  "array",
+			Items: &pschema.TypeSpec{Ref: "#/types/" + credentialsTypeToken},
+		}},
+	}
+	p.schema.Resources[fakeResourceTypeToken] = resourceSpec
+
+	createResp, err := createFakeResource(ctx, t, p, 0)
+	require.NoError(t, err)
+
+	outputs, err := plugin.UnmarshalProperties(createResp.GetProperties(), state.DefaultUnmarshalOpts)
+	require.NoError(t, err)
+
+	assert.True(t, outputs["token"].IsSecret())
+
+	credentials := outputs["credentials"].ObjectValue()
+	assert.False(t, credentials["keyId"].IsSecret())
+	assert.True(t, credentials["secretKey"].IsSecret())
+
+	for _, key := range outputs["keys"].ArrayValue() {
+		assert.False(t, key.ObjectValue()["keyId"].IsSecret())
+		assert.True(t, key.ObjectValue()["secretKey"].IsSecret())
+	}
+}
@@ -0,0 +1,199 @@
+package rest
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/pkg/errors"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/logging"
+)
+
+// configureServers sets the base URL and the servers of the provider config
+// from the servers of the OpenAPI doc. The server of the API is the one
+// whose description is the "providername:server" config, or else the first
+// one. The variables of its URL are set from the provider config, e.g.
+// "providername:region", or else from their defaults. The servers of paths
+// and operations that override it are resolved the same way.
+func (p *Provider) configureServers(vars map[string]string, cfg *providerConfig) error {
+	servers := p.openAPIDoc.Servers
+	if len(servers) == 0 {
+		return errors.New("the OpenAPI doc has no servers")
+	}
+
+	description := vars[fmt.Sprintf("%s:config:server", p.name)]
+	if description != "" && p.customBaseURL {
+		logging.V(3).Infof("The base URL was set with WithBaseURL, ignoring the server config")
+		description = ""
+	}
+
+	index, ok := findServer(servers, description)
+	if !ok {
+		return errors.Errorf("no server of the OpenAPI doc has the description %q (expected one of %v)", description, getServerDescriptions(servers))
+	}
+
+	serverVars := getServerVariables(p.name, vars)
+	baseURL, err := resolveServerURL(servers[index], serverVars)
+	if err != nil {
+		return errors.Wrapf(err, "resolving server url %s", servers[index].URL)
+	}
+
+	cfg.baseURL = baseURL
+	cfg.servers = openapi3.Servers{{URL: baseURL, Description: servers[index].Description}}
+	for i, server := range servers {
+		if i == index {
+			continue
+		}
+
+		// The servers that are not used only need to be routable, so the
+		// defaults of their variables are good enough.
+		serverURL, err := resolveServerURL(server, nil)
+		if err != nil {
+			logging.V(3).Infof("Skipping server %s: %v", server.URL, err)
+			continue
+		}
+		cfg.servers = append(cfg.servers, &openapi3.Server{URL: serverURL, Description: server.Description})
+	}
+
+	cfg.operationServerURLs = make(map[string]string)
+	for apiPath, pathItem := range p.openAPIDoc.Paths.Map() {
+		for method, op := range pathItem.Operations() {
+			opServers := pathItem.Servers
+			if op.Servers != nil && len(*op.Servers) > 0 {
+				opServers = *op.Servers
+			}
+			if len(opServers) == 0 {
+				continue
+			}
+
+			// The servers of an operation don't necessarily have the same
+			// descriptions as those of the OpenAPI doc.
+			index, ok := findServer(opServers, description)
+			if !ok {
+				index = 0
+			}
+
+			serverURL, err := resolveServerURL(opServers[index], serverVars)
+			if err != nil {
+				return errors.Wrapf(err, "resolving server url %s of %s %s", opServers[index].URL, method, apiPath)
+			}
+			cfg.operationServerURLs[getOperationKey(apiPath, method)] = serverURL
+		}
+	}
+
+	logging.V(3).Infof("Servers: base URL: %s, operation overrides: %v", cfg.baseURL, cfg.operationServerURLs)
+	return nil
+}
+
+// findServer returns the index of the server with the given description,
+// compared case-insensitively, or of the first server if description is
+// empty.
+func findServer(servers openapi3.Servers, description string) (int, bool) {
+	if description == "" {
+		return 0, true
+	}
+
+	i := slices.IndexFunc(servers, func(server *openapi3.Server) bool {
+		return strings.EqualFold(server.Description, description)
+	})
+	return i, i >= 0
+}
+
+func getServerDescriptions(servers openapi3.Servers) []string {
+	descriptions := make([]string, 0, len(servers))
+	for _, server := range servers {
+		descriptions = append(descriptions, server.Description)
+	}
+
+	return descriptions
+}
+
+// getServerVariables returns the provider config keyed by the names of the
+// config vars, which are the names of the server variables they set.
+func getServerVariables(providerName string, vars map[string]string) map[string]string {
+	prefix := providerName + ":config:"
+
+	serverVars := make(map[string]string)
+	for k, v := range vars {
+		if name, ok := strings.CutPrefix(k, prefix); ok {
+			serverVars[name] = v
+		}
+	}
+
+	return serverVars
+}
+
+// resolveServerURL returns the URL of a server with its variables replaced
+// by their values in vars, or else by their defaults. A value must be one
+// of the variable's enum, if it has one.
+func resolveServerURL(server *openapi3.Server, vars map[string]string) (string, error) {
+	serverURL := server.URL
+	for _, name := range slices.Sorted(maps.Keys(server.Variables)) {
+		variable := server.Variables[name]
+
+		value := vars[name]
+		if value == "" {
+			value = variable.Default
+		}
+
+		if len(variable.Enum) > 0 && !slices.Contains(variable.Enum, value) {
+			return "", errors.Errorf("value %q of server variable %s is not one of %v", value, name, variable.Enum)
+		}
+
+		serverURL = strings.ReplaceAll(serverURL, "{"+name+"}", value)
+	}
+
+	return serverURL, nil
+}
+
+func getOperationKey(apiPath, method string) string {
+	return strings.ToUpper(method) + " " + apiPath
+}
+
+// getServerURL returns the URL of the server to which the requests of an
+// operation are sent.
+func (p *Provider) getServerURL(apiPath, method string) string {
+	cfg := p.config()
+	if serverURL, ok := cfg.operationServerURLs[getOperationKey(apiPath, method)]; ok {
+		return serverURL
+	}
+
+	return cfg.baseURL
+}
+
+// getRouterDoc returns the OpenAPI doc from which the router of the
+// provider is created, with the resolved servers of the provider config.
+func (p *Provider) getRouterDoc(cfg *providerConfig) *openapi3.T {
+	doc := p.openAPIDoc
+	doc.Servers = cfg.servers
+	if len(cfg.operationServerURLs) == 0 {
+		return &doc
+	}
+
+	// The router only routes the servers of the OpenAPI doc and of paths,
+	// and a path without servers gets those of the previous path that has
+	// them. So every path is given its servers, including those of its
+	// operations.
+	paths := openapi3.NewPaths()
+	for apiPath, pathItem := range p.openAPIDoc.Paths.Map() {
+		item := *pathItem
+		item.Servers = slices.Clone(cfg.servers)
+		for _, method := range slices.Sorted(maps.Keys(pathItem.Operations())) {
+			serverURL, ok := cfg.operationServerURLs[getOperationKey(apiPath, method)]
+			if !ok {
+				continue
+			}
+
+			if !slices.ContainsFunc(item.Servers, func(server *openapi3.Server) bool { return server.URL == serverURL }) {
+				item.Servers = append(item.Servers, &openapi3.Server{URL: serverURL})
+			}
+		}
+		paths.Set(apiPath, &item)
+	}
+	doc.Paths = paths
+
+	return &doc
+}
@@ -0,0 +1,127 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+)
+
+func makeTestServersServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `{"id":"fake-id","another_prop":"output value"}`)
+	}))
+}
+
+// configureTestServers replaces the servers of the OpenAPI doc and
+// configures the provider again with vars.
+func configureTestServers(ctx context.Context, t *testing.T, p pulumirpc.ResourceProviderServer, servers openapi3.Servers, vars map[string]string) error {
+	t.Helper()
+
+	p.(*Provider).openAPIDoc.Servers = servers
+	_, err := p.Configure(ctx, &pulumirpc.ConfigureRequest{
+		Variables:              vars,
+		SendsOldInputs:         true,
+		SendsOldInputsToDelete: true,
+	})
+	return err
+}
+
+func TestServerVariablesAreSetFromConfig(t *testing.T) {
+	ctx := context.Background()
+
+	testServer := makeTestServersServer(t)
+	defer testServer.Close()
+	testServerURL, err := url.Parse(testServer.URL)
+	require.NoError(t, err)
+
+	p := makeTestGenericProvider(ctx, t, nil, nil)
+	servers := openapi3.Servers{{
+		URL: "http://{host}",
+		Variables: map[string]*openapi3.ServerVariable{
+			"host": {Default: "api.fake.com"},
+		},
+	}}
+
+	require.NoError(t, configureTestServers(ctx, t, p, servers, nil))
+	assert.Equal(t, "http://api.fake.com", p.(*Provider).GetBaseURL())
+
+	require.NoError(t, configureTestServers(ctx, t, p, servers, map[string]string{
+		"generic:config:host": testServerURL.Host,
+	}))
+	assert.Equal(t, testServer.URL, p.(*Provider).GetBaseURL())
+
+	readResp, err := readFakeResource(ctx, t, p)
+	require.NoError(t, err)
+	assert.Contains(t, readResp.GetProperties().AsMap(), "anotherProp")
+}
+
+func TestServerVariableMustBeInEnum(t *testing.T) {
+	ctx := context.Background()
+
+	p := makeTestGenericProvider(ctx, t, nil, nil)
+	servers := openapi3.Servers{{
+		URL: "https://{region}.api.fake.com",
+		Variables: map[string]*openapi3.ServerVariable{
+			"region": {Default: "us", Enum: []string{"us", "eu"}},
+		},
+	}}
+
+	require.NoError(t, configureTestServers(ctx, t, p, servers, map[string]string{"generic:config:region": "eu"}))
+	assert.Equal(t, "https://eu.api.fake.com", p.(*Provider).GetBaseURL())
+
+	err := configureTestServers(ctx, t, p, servers, map[string]string{"generic:config:region": "ap"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `value "ap" of server variable region is not one of [us eu]`)
+}
+
+func TestServerIsSelectedByDescription(t *testing.T) {
+	ctx := context.Background()
+
+	testServer := makeTestServersServer(t)
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, nil, nil)
+	servers := openapi3.Servers{
+		{URL: "https://api.fake.com", Description: "production"},
+		{URL: testServer.URL, Description: "sandbox"},
+	}
+
+	require.NoError(t, configureTestServers(ctx, t, p, servers, map[string]string{"generic:config:server": "Sandbox"}))
+	assert.Equal(t, testServer.URL, p.(*Provider).GetBaseURL())
+
+	_, err := readFakeResource(ctx, t, p)
+	require.NoError(t, err)
+
+	err = configureTestServers(ctx, t, p, servers, map[string]string{"generic:config:server": "staging"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `no server of the OpenAPI doc has the description "staging"`)
+}
+
+func TestOperationServersOverrideDocServers(t *testing.T) {
+	ctx := context.Background()
+
+	testServer := makeTestServersServer(t)
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, nil, nil)
+	p.(*Provider).openAPIDoc.Paths.Find("/v2/fakeresource/{resourceId}").Get.Servers = &openapi3.Servers{{URL: testServer.URL}}
+	require.NoError(t, configureTestServers(ctx, t, p, openapi3.Servers{{URL: "https://api.fake.com"}}, nil))
+
+	readResp, err := readFakeResource(ctx, t, p)
+	require.NoError(t, err)
+	assert.Contains(t, readResp.GetProperties().AsMap(), "anotherProp")
+
+	// Other operations are still sent to the server of the OpenAPI doc.
+	assert.Equal(t, "https://api.fake.com", p.(*Provider).getServerURL("/v2/fakeresource", http.MethodPost))
+}
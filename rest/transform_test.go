@@ -20,7 +20,7 @@ import (
 //go:embed testdata/generic/openapi.yml
 var genericOpenAPIEmbed string
 
-func makeTestGenericProviderWithOpts(ctx context.Context, t *testing.T, testServer *httptest.Server, providerCallback callback.ProviderCallback, sendsOldInputs bool) pulumirpc.ResourceProviderServer {
+func makeTestGenericProviderWithOpts(ctx context.Context, t *testing.T, testServer *httptest.Server, providerCallback callback.ProviderCallback, sendsOldInputs bool, opts ...Option) pulumirpc.ResourceProviderServer {
 	t.Helper()
 
 	openAPIBytes := []byte(genericOpenAPIEmbed)
@@ -44,7 +44,7 @@ func makeTestGenericProviderWithOpts(ctx context.Context, t *testing.T, testServ
 	updatedOpenAPIDocBytes, _ := yaml.Marshal(updatedOpenAPIDoc)
 	metadataBytes, _ := json.Marshal(metadata)
 
-	p, err := MakeProvider(nil, "generic", "", schemaJSON, updatedOpenAPIDocBytes, metadataBytes, testProviderCallback)
+	p, err := MakeProvider(nil, "generic", "", schemaJSON, updatedOpenAPIDocBytes, metadataBytes, testProviderCallback, opts...)
 
 	if err != nil {
 		t.Fatalf("Could not create a provider instance: %v", err)
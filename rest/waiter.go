@@ -0,0 +1,207 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/logging"
+
+	providerGen "github.com/cloudy-sky-software/pulschema/pkg"
+)
+
+// ExtWaiter is the OpenAPI vendor extension that can be added to the
+// read (GET) operation of a resource to declare its WaiterHint.
+const ExtWaiter = "x-pulumi-waiter"
+
+const defaultWaiterTimeout = 30 * time.Minute
+
+// WaiterHint declares the status property of a resource whose value
+// indicates that the resource is ready to be used after it is created
+// or updated.
+type WaiterHint struct {
+	// StatusProperty is the name of the status property in the API
+	// response. Nested properties can be separated by a `.`.
+	StatusProperty string `json:"statusProperty"`
+	// ReadyValues are the values of the status property that
+	// indicate that the resource is ready.
+	ReadyValues []string `json:"readyValues"`
+	// FailedValues are the values of the status property that
+	// indicate that the resource will never become ready.
+	FailedValues []string `json:"failedValues,omitempty"`
+	// TimeoutSeconds is how long to wait for the resource to
+	// become ready when the engine did not send a custom timeout.
+	TimeoutSeconds float64 `json:"timeoutSeconds,omitempty"`
+}
+
+// DeletionWaiterHint opts a resource type in to waiting until its read
+// endpoint no longer finds it after it is deleted.
+type DeletionWaiterHint struct {
+	// TimeoutSeconds is how long to wait for the resource to be
+	// removed when the engine did not send a custom timeout.
+	TimeoutSeconds float64 `json:"timeoutSeconds,omitempty"`
+}
+
+// getWaiterHint returns the waiter for a resource type from the metadata,
+// or from the vendor extension of its read operation in the OpenAPI doc.
+func (p *Provider) getWaiterHint(resourceTypeToken string, crudMap *providerGen.CRUDOperationsMap) (*WaiterHint, error) {
+	if hint, ok := p.frameworkMetadata.WaiterMap[resourceTypeToken]; ok {
+		return &hint, nil
+	}
+
+	if crudMap.R == nil {
+		return nil, nil
+	}
+
+	pathItem := p.openAPIDoc.Paths.Find(*crudMap.R)
+	if pathItem == nil || pathItem.Get == nil {
+		return nil, nil
+	}
+
+	ext, ok := pathItem.Get.Extensions[ExtWaiter]
+	if !ok {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(ext)
+	if err != nil {
+		return nil, errors.Wrapf(err, "marshaling %s extension", ExtWaiter)
+	}
+
+	var hint WaiterHint
+	if err := json.Unmarshal(b, &hint); err != nil {
+		return nil, errors.Wrapf(err, "unmarshaling %s extension", ExtWaiter)
+	}
+
+	return &hint, nil
+}
+
+// waitForResourceReady polls the read endpoint of a resource until its
+// status property has one of the ready values of its waiter. The outputs
+// are returned as-is if the resource type does not have a waiter. If the
+// resource does not become ready, its latest known state is returned
+// with the error.
+func (p *Provider) waitForResourceReady(ctx context.Context, resourceTypeToken string, crudMap *providerGen.CRUDOperationsMap, inputs resource.PropertyMap, currentState resource.PropertyMap, outputs interface{}, timeoutSeconds float64) (interface{}, error) {
+	hint, err := p.getWaiterHint(resourceTypeToken, crudMap)
+	if err != nil {
+		return outputs, errors.Wrap(err, "getting waiter")
+	}
+	if hint == nil {
+		return outputs, nil
+	}
+
+	if crudMap.R == nil {
+		return outputs, errors.Errorf("resource type %s has a waiter but its read endpoint is unknown", resourceTypeToken)
+	}
+	if hint.StatusProperty == "" || len(hint.ReadyValues) == 0 {
+		return outputs, errors.Errorf("waiter for resource type %s must have a status property and ready values", resourceTypeToken)
+	}
+
+	outputsMap, ok := outputs.(map[string]interface{})
+	if !ok {
+		return outputs, errors.Errorf("cannot wait for resource type %s since the response is not an object", resourceTypeToken)
+	}
+
+	timeout := time.Duration(timeoutSeconds * float64(time.Second))
+	if timeout <= 0 {
+		timeout = time.Duration(hint.TimeoutSeconds * float64(time.Second))
+	}
+	if timeout <= 0 {
+		timeout = defaultWaiterTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	op := &asyncOperation{
+		hint: AsyncOperationHint{
+			StatusProperty:  hint.StatusProperty,
+			SucceededValues: hint.ReadyValues,
+			FailedValues:    hint.FailedValues,
+		},
+		newPollRequest: func(ctx context.Context) (*http.Request, error) {
+			m := currentState.Copy()
+			maps.Copy(m, resource.NewPropertyMapFromMap(outputsMap))
+			return p.CreateGetRequest(ctx, *crudMap.R, inputs, &m)
+		},
+		readsResource:     true,
+		pendingOnNotFound: true,
+	}
+
+	logging.V(3).Infof("Waiting up to %v for %s to have one of %v as its %s", timeout, resourceTypeToken, hint.ReadyValues, hint.StatusProperty)
+
+	result, err := p.pollAsyncOperation(ctx, op)
+	if err != nil {
+		err = errors.Wrap(err, "waiting for resource to be ready")
+		if op.lastResource != nil {
+			return op.lastResource, err
+		}
+		return outputs, err
+	}
+	if result == nil {
+		return outputs, nil
+	}
+
+	return result, nil
+}
+
+// waitForResourceDeletion polls the read endpoint of a deleted resource
+// until it no longer finds the resource. Nothing is done unless the
+// resource type opted in with a deletion waiter.
+func (p *Provider) waitForResourceDeletion(ctx context.Context, resourceTypeToken string, crudMap *providerGen.CRUDOperationsMap, inputs resource.PropertyMap, oldInputs resource.PropertyMap) error {
+	hint, ok := p.frameworkMetadata.DeletionWaiterMap[resourceTypeToken]
+	if !ok {
+		return nil
+	}
+
+	if crudMap.R == nil {
+		return errors.Errorf("resource type %s has a deletion waiter but its read endpoint is unknown", resourceTypeToken)
+	}
+
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		timeout := time.Duration(hint.TimeoutSeconds * float64(time.Second))
+		if timeout <= 0 {
+			timeout = defaultWaiterTimeout
+		}
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	op := &asyncOperation{
+		newPollRequest:     p.newDeletedResourceReadRequestFunc(crudMap, inputs, oldInputs),
+		readsResource:      true,
+		completeOnNotFound: true,
+		isNotFound:         p.isResourceNotFoundFunc(resourceTypeToken),
+	}
+
+	logging.V(3).Infof("Waiting for %s to be removed", resourceTypeToken)
+
+	if _, err := p.pollAsyncOperation(ctx, op); err != nil {
+		return errors.Wrap(err, "waiting for resource to be removed")
+	}
+
+	return nil
+}
+
+// withOperationTimeout returns a context that is done after the custom
+// timeout in seconds that the engine sent for a resource operation, or
+// when the provider is cancelled.
+func (p *Provider) withOperationTimeout(ctx context.Context, timeoutSeconds float64) (context.Context, context.CancelFunc) {
+	ctx, cancel := p.withCancellation(ctx)
+	if timeoutSeconds <= 0 {
+		return ctx, cancel
+	}
+
+	ctx, cancelTimeout := context.WithTimeout(ctx, time.Duration(timeoutSeconds*float64(time.Second)))
+	return ctx, func() {
+		cancelTimeout()
+		cancel()
+	}
+}
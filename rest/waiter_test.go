@@ -0,0 +1,155 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+
+	"github.com/cloudy-sky-software/pulumi-provider-framework/state"
+)
+
+const fakeResourceTypeToken = "generic:fakeresource/v2:FakeResource"
+
+func makeTestWaiterServer(t *testing.T, statuses ...string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var readCount atomic.Int32
+
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/fakeresource" && r.Method == http.MethodPost:
+			_, _ = io.WriteString(w, `{"id":"fake-id","status":"provisioning"}`)
+		case r.URL.Path == fakeResourceURLPath:
+			i := int(readCount.Add(1)) - 1
+			status := statuses[min(i, len(statuses)-1)]
+			_, _ = io.WriteString(w, `{"id":"fake-id","status":"`+status+`"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+
+	return testServer, &readCount
+}
+
+func createFakeResource(ctx context.Context, t *testing.T, p pulumirpc.ResourceProviderServer, timeout float64) (*pulumirpc.CreateResponse, error) {
+	t.Helper()
+
+	props, err := plugin.MarshalProperties(resource.NewPropertyMapFromMap(map[string]any{
+		"simpleProp": "somevalue",
+	}), state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	return p.Create(ctx, &pulumirpc.CreateRequest{
+		Name:       "myResource",
+		Properties: props,
+		Type:       fakeResourceTypeToken,
+		Urn:        "urn:pulumi:some-stack::some-project::" + fakeResourceTypeToken + "::myResource",
+		Timeout:    timeout,
+	})
+}
+
+func TestCreateWaitsForResourceToBeReady(t *testing.T) {
+	ctx := context.Background()
+
+	testServer, readCount := makeTestWaiterServer(t, "provisioning", "provisioning", "available")
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	p.(*Provider).asyncPollInterval = time.Millisecond
+	p.(*Provider).frameworkMetadata.WaiterMap = map[string]WaiterHint{
+		fakeResourceTypeToken: {
+			StatusProperty: "status",
+			ReadyValues:    []string{"available"},
+		},
+	}
+
+	createResp, err := createFakeResource(ctx, t, p, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), readCount.Load())
+	assert.Equal(t, "available", createResp.GetProperties().AsMap()["status"])
+}
+
+func TestCreateFailsWhenResourceFailsToBecomeReady(t *testing.T) {
+	ctx := context.Background()
+
+	testServer, _ := makeTestWaiterServer(t, "provisioning", "degraded")
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	p.(*Provider).asyncPollInterval = time.Millisecond
+	p.(*Provider).frameworkMetadata.WaiterMap = map[string]WaiterHint{
+		fakeResourceTypeToken: {
+			StatusProperty: "status",
+			ReadyValues:    []string{"available"},
+			FailedValues:   []string{"degraded"},
+		},
+	}
+
+	_, err := createFakeResource(ctx, t, p, 0)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "degraded")
+}
+
+func TestWaiterRespectsCustomTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	testServer, _ := makeTestWaiterServer(t, "configuring")
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+	p.(*Provider).asyncPollInterval = time.Millisecond
+	p.(*Provider).asyncMaxPollInterval = 5 * time.Millisecond
+	p.(*Provider).frameworkMetadata.WaiterMap = map[string]WaiterHint{
+		fakeResourceTypeToken: {
+			StatusProperty: "status",
+			ReadyValues:    []string{"available"},
+		},
+	}
+
+	_, err := createFakeResource(ctx, t, p, 0.05)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+
+	// The resource was created so it is reported with its latest state.
+	initErr := requireResourceInitFailed(t, err)
+	assert.Equal(t, "fake-id", initErr.GetId())
+	assert.Equal(t, "configuring", initErr.GetProperties().AsMap()["status"])
+}
+
+func TestWaiterFromOpenAPIExtension(t *testing.T) {
+	ctx := context.Background()
+
+	p := makeTestGenericProvider(ctx, t, nil, nil).(*Provider)
+	crudMap := p.metadata.ResourceCRUDMap[fakeResourceTypeToken]
+	require.NotNil(t, crudMap.R)
+
+	hint, err := p.getWaiterHint(fakeResourceTypeToken, crudMap)
+	require.NoError(t, err)
+	assert.Nil(t, hint)
+
+	p.openAPIDoc.Paths.Find(*crudMap.R).Get.Extensions = map[string]any{
+		ExtWaiter: map[string]any{
+			"statusProperty": "status.phase",
+			"readyValues":    []any{"Running"},
+		},
+	}
+
+	hint, err = p.getWaiterHint(fakeResourceTypeToken, crudMap)
+	require.NoError(t, err)
+	require.NotNil(t, hint)
+	assert.Equal(t, "status.phase", hint.StatusProperty)
+	assert.Equal(t, []string{"Running"}, hint.ReadyValues)
+}
@@ -0,0 +1,141 @@
+package rest
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+
+	providerGen "github.com/cloudy-sky-software/pulschema/pkg"
+)
+
+// arrayItemsPathSegment is the segment of a property path that denotes
+// every item of an array.
+const arrayItemsPathSegment = "*"
+
+// getWriteOnlyPropertyPaths returns the paths of the properties that the
+// create request schema of a resource declares as `writeOnly`. The paths
+// use the SDK names of the properties.
+//
+// The API never returns the values of writeOnly properties, e.g.
+// passwords, so their values are preserved from the prior state.
+func (p *Provider) getWriteOnlyPropertyPaths(crudMap *providerGen.CRUDOperationsMap) []resource.PropertyPath {
+	schema := p.getCreateRequestSchema(crudMap)
+	if schema == nil {
+		return nil
+	}
+
+	var paths []resource.PropertyPath
+	p.collectWriteOnlyPropertyPaths(nil, schema, make(map[*openapi3.Schema]bool), &paths)
+
+	return paths
+}
+
+func (p *Provider) collectWriteOnlyPropertyPaths(path resource.PropertyPath, schema *openapi3.Schema, visiting map[*openapi3.Schema]bool, paths *[]resource.PropertyPath) {
+	// Schemas can be recursive.
+	if schema == nil || visiting[schema] {
+		return
+	}
+	visiting[schema] = true
+	defer delete(visiting, schema)
+
+	for _, apiName := range slices.Sorted(maps.Keys(schema.Properties)) {
+		propSchema := schema.Properties[apiName].Value
+		if propSchema == nil {
+			continue
+		}
+
+		propPath := appendPath(path, getOrKey(p.metadata.APIToSDKNameMap, apiName))
+		if propSchema.WriteOnly {
+			if !slices.ContainsFunc(*paths, func(existing resource.PropertyPath) bool {
+				return existing.String() == propPath.String()
+			}) {
+				*paths = append(*paths, propPath)
+			}
+			continue
+		}
+
+		p.collectWriteOnlyPropertyPaths(propPath, propSchema, visiting, paths)
+	}
+
+	if schema.Items != nil {
+		p.collectWriteOnlyPropertyPaths(appendPath(path, arrayItemsPathSegment), schema.Items.Value, visiting, paths)
+	}
+
+	for _, schemaRefs := range []openapi3.SchemaRefs{schema.AllOf, schema.OneOf, schema.AnyOf} {
+		for _, schemaRef := range schemaRefs {
+			p.collectWriteOnlyPropertyPaths(path, schemaRef.Value, visiting, paths)
+		}
+	}
+}
+
+// preserveWriteOnlyProperties copies the values of the writeOnly
+// properties of a resource from the prior properties to the current ones,
+// since the API does not return them, and marks them as secrets.
+func (p *Provider) preserveWriteOnlyProperties(crudMap *providerGen.CRUDOperationsMap, prior, current resource.PropertyMap) {
+	for _, path := range p.getWriteOnlyPropertyPaths(crudMap) {
+		copyPropertyValue(path, prior, current)
+	}
+}
+
+// copyPropertyValue copies the value at path from one property map to
+// another as a secret. Objects on the path that don't exist in the
+// destination are created.
+func copyPropertyValue(path resource.PropertyPath, from, to resource.PropertyMap) {
+	key := resource.PropertyKey(path[0].(string))
+	src, ok := from[key]
+	if !ok || src.IsNull() {
+		return
+	}
+
+	if len(path) == 1 {
+		if src.IsComputed() || src.ContainsSecrets() {
+			to[key] = src
+		} else {
+			to[key] = resource.MakeSecret(src)
+		}
+		return
+	}
+
+	srcValue, known := unwrapPropertyValue(src)
+	if !known {
+		return
+	}
+
+	dst, ok := to[key]
+	if !ok || dst.IsNull() {
+		if !srcValue.IsObject() {
+			return
+		}
+		dst = resource.NewObjectProperty(resource.PropertyMap{})
+		to[key] = dst
+	}
+
+	dstValue, known := unwrapPropertyValue(dst)
+	if !known {
+		return
+	}
+
+	if path[1] == arrayItemsPathSegment {
+		if !srcValue.IsArray() || !dstValue.IsArray() || len(path) < 3 {
+			return
+		}
+
+		srcItems := srcValue.ArrayValue()
+		dstItems := dstValue.ArrayValue()
+		for i := range min(len(srcItems), len(dstItems)) {
+			srcItem, srcKnown := unwrapPropertyValue(srcItems[i])
+			dstItem, dstKnown := unwrapPropertyValue(dstItems[i])
+			if srcKnown && dstKnown && srcItem.IsObject() && dstItem.IsObject() {
+				copyPropertyValue(path[2:], srcItem.ObjectValue(), dstItem.ObjectValue())
+			}
+		}
+		return
+	}
+
+	if srcValue.IsObject() && dstValue.IsObject() {
+		copyPropertyValue(path[1:], srcValue.ObjectValue(), dstValue.ObjectValue())
+	}
+}
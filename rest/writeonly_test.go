@@ -0,0 +1,92 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
+	pulumirpc "github.com/pulumi/pulumi/sdk/v3/proto/go"
+
+	"github.com/cloudy-sky-software/pulumi-provider-framework/state"
+)
+
+func TestWriteOnlyPropertyPaths(t *testing.T) {
+	ctx := context.Background()
+
+	p := makeTestGenericProvider(ctx, t, nil, nil).(*Provider)
+
+	var paths []string
+	for _, path := range p.getWriteOnlyPropertyPaths(p.metadata.ResourceCRUDMap[validatedResourceTypeToken]) {
+		paths = append(paths, path.String())
+	}
+
+	assert.Equal(t, []string{"adminPassword", "settings.apiToken"}, paths)
+}
+
+func TestWriteOnlyPropertiesArePreservedOnRead(t *testing.T) {
+	ctx := context.Background()
+
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// The API never returns the values of writeOnly properties.
+		_, _ = io.WriteString(w, `{"id":"fake-id","region":"sfo","settings":{"mode":"fast"}}`)
+	}))
+	testServer.EnableHTTP2 = true
+	testServer.Start()
+	defer testServer.Close()
+
+	p := makeTestGenericProvider(ctx, t, testServer, nil)
+
+	inputs := resource.NewPropertyMapFromMap(map[string]any{
+		"region":        "nyc",
+		"adminPassword": "hunter2",
+		"settings": map[string]any{
+			"mode":     "fast",
+			"apiToken": "some-token",
+		},
+	})
+
+	props, err := plugin.MarshalProperties(inputs, state.DefaultMarshalOpts)
+	require.NoError(t, err)
+
+	createResp, err := p.Create(ctx, &pulumirpc.CreateRequest{
+		Urn:        "urn:pulumi:some-stack::some-project::" + validatedResourceTypeToken + "::myResource",
+		Properties: props,
+	})
+	require.NoError(t, err)
+
+	outputs, err := plugin.UnmarshalProperties(createResp.GetProperties(), state.DefaultUnmarshalOpts)
+	require.NoError(t, err)
+	require.True(t, outputs["adminPassword"].IsSecret(), "Expected the writeOnly property to be a secret in the outputs")
+	assert.Equal(t, "hunter2", outputs["adminPassword"].SecretValue().Element.StringValue())
+
+	readResp, err := p.Read(ctx, &pulumirpc.ReadRequest{
+		Id:         "fake-id",
+		Urn:        "urn:pulumi:some-stack::some-project::" + validatedResourceTypeToken + "::myResource",
+		Inputs:     props,
+		Properties: createResp.GetProperties(),
+	})
+	require.NoError(t, err)
+
+	readInputs, err := plugin.UnmarshalProperties(readResp.GetInputs(), state.DefaultUnmarshalOpts)
+	require.NoError(t, err)
+	assert.Equal(t, "sfo", readInputs["region"].StringValue(), "Expected drift of other properties to be reported")
+	require.True(t, readInputs["adminPassword"].IsSecret())
+	assert.Equal(t, "hunter2", readInputs["adminPassword"].SecretValue().Element.StringValue())
+	apiToken := readInputs["settings"].ObjectValue()["apiToken"]
+	require.True(t, apiToken.IsSecret())
+	assert.Equal(t, "some-token", apiToken.SecretValue().Element.StringValue())
+
+	readOutputs, err := plugin.UnmarshalProperties(readResp.GetProperties(), state.DefaultUnmarshalOpts)
+	require.NoError(t, err)
+	require.True(t, readOutputs["adminPassword"].IsSecret())
+	apiToken = readOutputs["settings"].ObjectValue()["apiToken"]
+	require.True(t, apiToken.IsSecret())
+	assert.Equal(t, "some-token", apiToken.SecretValue().Element.StringValue())
+}
@@ -6,7 +6,11 @@ import (
 	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
 )
 
-const stateKeyInputs = "__inputs"
+const (
+	stateKeyInputs         = "__inputs"
+	stateKeyETag           = "__etag"
+	stateKeyIdempotencyKey = "__idempotencyKey"
+)
 
 // DefaultMarshalOpts is the default options used when marshaling inputs.
 var DefaultMarshalOpts = plugin.MarshalOptions{KeepUnknowns: true, KeepSecrets: true, SkipNulls: true}
@@ -43,6 +47,46 @@ func GetOldInputs(state resource.PropertyMap) resource.PropertyMap {
 	return nil
 }
 
+// SetETag stores the ETag of a resource in its state.
+func SetETag(state resource.PropertyMap, etag string) {
+	state[stateKeyETag] = resource.NewStringProperty(etag)
+}
+
+// GetETag returns the ETag stored in the state of a resource, if any.
+func GetETag(state resource.PropertyMap) string {
+	return getStringState(state, stateKeyETag)
+}
+
+// SetIdempotencyKey stores the idempotency key of the create request of a
+// resource in its state.
+func SetIdempotencyKey(state resource.PropertyMap, key string) {
+	state[stateKeyIdempotencyKey] = resource.NewStringProperty(key)
+}
+
+// GetIdempotencyKey returns the idempotency key stored in the state of a
+// resource, if any.
+func GetIdempotencyKey(state resource.PropertyMap) string {
+	return getStringState(state, stateKeyIdempotencyKey)
+}
+
+// getStringState returns the string stored under key in the state of a
+// resource, or an empty string if there is none.
+func getStringState(state resource.PropertyMap, key resource.PropertyKey) string {
+	v, ok := state[key]
+	if !ok {
+		return ""
+	}
+
+	if v.IsSecret() {
+		v = v.SecretValue().Element
+	}
+	if !v.IsString() {
+		return ""
+	}
+
+	return v.StringValue()
+}
+
 // ApplyDiffFromCloudProvider returns a property map by overlaying the diff
 // between new and old inputs.
 func ApplyDiffFromCloudProvider(newProps resource.PropertyMap, oldProps resource.PropertyMap) resource.PropertyMap {
@@ -20,3 +20,19 @@ func TestGetResourceState(t *testing.T) {
 	state := GetResourceState(outputs, resource.NewPropertyMapFromMap(inputs))
 	assert.True(t, state.HasValue(resource.PropertyKey(stateKeyInputs)))
 }
+
+func TestETag(t *testing.T) {
+	state := GetResourceState(map[string]interface{}{"id": "someid"}, resource.PropertyMap{})
+	assert.Empty(t, GetETag(state))
+
+	SetETag(state, `"v1"`)
+	assert.Equal(t, `"v1"`, GetETag(state))
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	state := GetResourceState(map[string]interface{}{"id": "someid"}, resource.PropertyMap{})
+	assert.Empty(t, GetIdempotencyKey(state))
+
+	SetIdempotencyKey(state, "some-key")
+	assert.Equal(t, "some-key", GetIdempotencyKey(state))
+}